@@ -10,7 +10,13 @@
 package lac
 
 import (
+	"fmt"
+	"os"
 	"reflect"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"time"
 	"unsafe"
 )
 
@@ -20,11 +26,19 @@ var (
 	// our memory is much cheaper than systems,
 	// so we can be more aggressive than `append`.
 	SliceExtendRatio = 2.5
+	// slices grow by SliceExtendRatio up to MaxAllocBytes,
+	// then grow linearly by SliceGrowStep bytes to avoid allocating huge chunks.
+	MaxAllocBytes = 256 << 20
+	SliceGrowStep = 16 << 20
 
 	BugfixClearPointerInMem = true
 	BugfixCorruptOtherMem   = true
 
 	ZeroMemOnFree = false
+
+	// NewString reuses the input if it is already in the chunks of the Allocator, e.g. substrings of Lac strings.
+	// the checking costs a scan of the chunks.
+	NewStringReuseInternal = false
 )
 
 func (p *AllocatorPool) Get() *Allocator {
@@ -32,17 +46,37 @@ func (p *AllocatorPool) Get() *Allocator {
 		return nil
 	}
 	ac := p.Pool.Get()
+	ac.released.Store(false)
+	ac.chunkPool = p.localChunkPool()
+	if p.debugMode {
+		ac.registerDebug()
+	}
 	return ac
 }
 
+// Release resets ac and puts it back to the pool.
+// Releasing again before getting it from the pool is no-op with a warning, instead of corrupting the pool.
 func (ac *Allocator) Release() {
 	if ac == nil {
 		return
 	}
+	if !ac.released.CompareAndSwap(false, true) {
+		warnf(ac.acPool.Logger, "potential bug: Lac#%d is released twice\n", ac.id)
+		return
+	}
 	ac.reset()
 	ac.acPool.Put(ac)
 }
 
+// WithAllocator gets an Allocator from the pool for the duration of fn,
+// and releases it after fn returns, even on panic.
+// There is no goroutine binding in this package, pass ac explicitly to nested calls.
+func WithAllocator(p *AllocatorPool, fn func(ac *Allocator)) {
+	ac := p.Get()
+	defer ac.DecRef()
+	fn(ac)
+}
+
 // IncRef should be called before and outside the new goroutine, never be in the new goroutine,
 // otherwise the execution of new goroutine may be delayed after the caller quit,
 // which may cause a UseAfterFree error. e.g.
@@ -78,30 +112,358 @@ func (ac *Allocator) DecRef() {
 	}
 	if n := ac.refCnt.Add(-1); n <= 0 {
 		if n < 0 {
-			errorf(ac.acPool, "potential bug: ref cnt is negative: %v", n)
+			errorf(ac.acPool, "potential bug: ref cnt of Lac#%d is negative: %v", ac.id, n)
 		}
 		ac.Release()
 	}
 }
 
+// Pool returns the pool the Allocator belongs to, nil if ac is nil.
+func (ac *Allocator) Pool() *AllocatorPool {
+	if ac == nil {
+		return nil
+	}
+	return ac.acPool
+}
+
+func (p *AllocatorPool) ChunkSize() int {
+	if p == nil {
+		return 0
+	}
+	return p.chunkPool.ChunkSize
+}
+
+// ID returns the unique id of ac assigned on creation, 0 if ac is nil.
+func (ac *Allocator) ID() uint64 {
+	if ac == nil {
+		return 0
+	}
+	return ac.id
+}
+
+// CycleStats returns the count of allocations and the bytes requested since ac was got from the pool,
+// e.g. sampled right before Release to find the heavy request types for right-sizing the chunk size:
+//
+//	objects, bytes := ac.CycleStats()
+//	metrics.Observe(reqType, objects, bytes)
+//	ac.Release()
+//
+// objects is 0 unless CountObjects of the pool is enabled.
+func (ac *Allocator) CycleStats() (objects, bytes int64) {
+	if ac == nil {
+		return 0, 0
+	}
+	return atomic.LoadInt64(&ac.objects), atomic.LoadInt64(&ac.requested)
+}
+
+// LastCycleStats is CycleStats of the cycle ended by the last reset of ac.
+// The pool may hand ac to any request, so the numbers belong to the previous user of ac,
+// only use it for the pool-wide sampling, use CycleStats for the per-request ones.
+func (ac *Allocator) LastCycleStats() (objects, bytes int64) {
+	if ac == nil {
+		return 0, 0
+	}
+	return ac.lastObjects, ac.lastBytes
+}
+
+// Chunks yields the used region of each chunk in allocation order to the returned iterator, e.g. snapshotting
+// the raw bytes of a self-contained layout to disk or network, then restoring it into the bytes from NewSlice[byte]:
+//
+//	ac.Chunks()(func(b []byte) bool {
+//		_, err := w.Write(b)
+//		return err == nil
+//	})
+//
+// The iterator can be ranged over directly since Go 1.23.
+// Only meaningful for pointer-free or offset-based data, pointers are invalid after restoring.
+// Allocations served by the heap are not included, see HeapFallbackAbove, and the regions may
+// contain the alignment padding. Must not allocate concurrently, the bytes are invalid after ac is released.
+func (ac *Allocator) Chunks() func(yield func([]byte) bool) {
+	return func(yield func([]byte) bool) {
+		if ac == nil {
+			return
+		}
+		for _, h := range ac.chunks {
+			if h.Len == 0 {
+				continue
+			}
+			if !yield(unsafe.Slice((*byte)(h.Data), h.Len)) {
+				return
+			}
+		}
+	}
+}
+
+// CurrentChunkFree returns the free bytes of the current chunk,
+// allocations larger than this will start a new chunk.
+func (ac *Allocator) CurrentChunkFree() int {
+	if ac == nil {
+		return 0
+	}
+	cur := atomic.LoadPointer(&ac.curChunk)
+	if cur == nil {
+		return 0
+	}
+	h := (*sliceHeader)(cur)
+	return h.Cap - loadLen(h)
+}
+
+// AvailableWithoutGrowth returns the bytes can be allocated without creating new chunks,
+// i.e. the free space of the current chunk plus the chunks in the chunk pool, which is shared by other allocators.
+// Single allocation larger than the chunk size always creates a new chunk.
+// The previous chunks are never revisited, so their free space is not counted.
+func (ac *Allocator) AvailableWithoutGrowth() int64 {
+	if ac == nil {
+		return 0
+	}
+	cp := ac.chunkPool
+	cp.m.Lock()
+	pooled := len(cp.pool)
+	cp.m.Unlock()
+	return int64(ac.CurrentChunkFree()) + int64(pooled)*int64(cp.ChunkSize)
+}
+
+// FreeLast reclaims the last allocation of n bytes at ptr if it's still at the tip of the current chunk,
+// e.g. the speculative allocation turned out unneeded. Returns false if it can't be freed.
+// Only works in single-threaded mode, and never when checking pointers since the checker may track the object.
+// ptr must never be used after freed.
+func (ac *Allocator) FreeLast(ptr unsafe.Pointer, n int) bool {
+	if ac == nil || ptr == nil || ac.refCnt.Load() != 1 || ac.curChunk == nil || ac.acPool.scanObjects() {
+		return false
+	}
+	h := (*sliceHeader)(ac.curChunk)
+	sz := alignedSize(n)
+	if sz > h.Len || unsafe.Add(h.Data, h.Len-sz) != ptr {
+		return false
+	}
+	h.Len -= sz
+	ac.requested -= int64(n)
+	return true
+}
+
+// CMem allocates n zeroed bytes for passing to cgo, returns nil if n <= 0.
+// The chunks are pointer-free and never moved, so it should be accepted by the cgocheck like other pointer-free Go memory.
+// The C side must not retain it after ac is released,
+// and never store Go pointers into it since the GC doesn't scan the chunks.
+func (ac *Allocator) CMem(n int) unsafe.Pointer {
+	if n <= 0 {
+		return nil
+	}
+	if ac == nil {
+		b := make([]byte, n)
+		return unsafe.Pointer(&b[0])
+	}
+	return ac.alloc(n, true)
+}
+
+// page size of the OS, usually 4096, see NewPageAlignedBytes.
+var pageSize = os.Getpagesize()
+
+// NewPageAlignedBytes allocates n bytes starting at a multiple of the OS page size,
+// e.g. buffers of O_DIRECT IO or madvise. Up to a page is wasted as the padding,
+// and the large buffers are served by the oversized chunks.
+// The bytes may contain the data of previous cycles like NewSliceUninit, zero them if needed,
+// they are zeroed only if ac is nil. Thread-safe unlike AlignTo.
+func (ac *Allocator) NewPageAlignedBytes(n int) []byte {
+	b := NewSlice[byte](ac, n+pageSize-1, n+pageSize-1)
+	off := int(-uintptr(unsafe.Pointer(&b[0])) & uintptr(pageSize-1))
+	return b[off : off+n : off+n]
+}
+
+// AlignTo pads the current chunk so that the next allocation starts at a multiple of align,
+// a building block for hand-rolled layouts over the bytes from NewSlice[byte].
+// align must be a power of two and not larger than half of the chunk size.
+// Not thread-safe, concurrent allocations may break the alignment.
+func (ac *Allocator) AlignTo(align int) {
+	if align <= 0 || align&(align-1) != 0 {
+		panic(fmt.Errorf("lac.AlignTo: %v is not power of two", align))
+	}
+	// allocations are always ptrSize aligned.
+	if ac == nil || align <= ptrSize {
+		return
+	}
+	if align > ac.chunkPool.ChunkSize/2 {
+		panic(fmt.Errorf("lac.AlignTo: %v is larger than half of the chunk size", align))
+	}
+
+	for {
+		if cur := ac.curChunk; cur != nil {
+			h := (*sliceHeader)(cur)
+			pad := int(-(uintptr(h.Data) + uintptr(h.Len)) & uintptr(align-1))
+			if h.Len+pad < h.Cap {
+				h.Len += pad
+				return
+			}
+			// not enough space, skip the rest.
+			h.Len = h.Cap
+		}
+		// start a new chunk.
+		ac.alloc(ptrSize, false)
+	}
+}
+
 //============================================================================
 // Allocation APIs
 //============================================================================
 
 func New[T any](ac *Allocator) (r *T) {
 	if ac == nil {
-		return new(T)
+		r = new(T)
+		runTypeInit(r)
+		return r
+	}
+
+	k := typeKind[T]()
+	switch k {
+	case reflect.Interface, reflect.Func, reflect.Chan:
+		panic(fmt.Errorf("lac.New: unsupported %v type %v, allocate a concrete type and Attach it instead", k, reflect.TypeOf(r).Elem()))
 	}
 
 	r = (*T)(ac.alloc(int(unsafe.Sizeof(*r)), true))
-	if ac.acPool.debugMode {
-		if reflect.TypeOf(r).Elem().Kind() == reflect.Struct {
+	runTypeInit(r)
+	if ac.acPool.scanObjects() {
+		if k == reflect.Struct {
+			ac.debugScan(r)
+			if ac.acPool.debugMode {
+				warnHeapFields(ac.acPool.Logger, reflect.TypeOf(r).Elem())
+			}
+		}
+	}
+	return r
+}
+
+// NewUninit is same as New but skips zeroing the memory, which may contain the data of previous cycles.
+// Caller must set every field immediately, WARNING: storing into a pointer field containing garbage
+// may crash the write barrier, only use it in the hot path after benchmarking, prefer New otherwise.
+func NewUninit[T any](ac *Allocator) (r *T) {
+	if ac == nil {
+		return new(T)
+	}
+
+	k := typeKind[T]()
+	switch k {
+	case reflect.Interface, reflect.Func, reflect.Chan:
+		panic(fmt.Errorf("lac.NewUninit: unsupported %v type %v, allocate a concrete type and Attach it instead", k, reflect.TypeOf(r).Elem()))
+	}
+
+	r = (*T)(ac.alloc(int(unsafe.Sizeof(*r)), false))
+	if ac.acPool.scanObjects() {
+		if k == reflect.Struct {
 			ac.debugScan(r)
 		}
 	}
 	return r
 }
 
+// NewReflect is the reflection version of New, returns an addressable zeroed value of type t allocated from ac,
+// e.g. for the serializers driven by reflect.Type.
+func (ac *Allocator) NewReflect(t reflect.Type) reflect.Value {
+	if ac == nil {
+		r := reflect.New(t)
+		runTypeInitReflect(t, r.UnsafePointer())
+		return r.Elem()
+	}
+
+	k := t.Kind()
+	switch k {
+	case reflect.Interface, reflect.Func, reflect.Chan:
+		panic(fmt.Errorf("lac.NewReflect: unsupported %v type %v, allocate a concrete type and Attach it instead", k, t))
+	}
+
+	r := reflect.NewAt(t, ac.alloc(int(t.Size()), true))
+	runTypeInitReflect(t, r.UnsafePointer())
+	if ac.acPool.scanObjects() {
+		if k == reflect.Struct {
+			ac.debugScan(r.Interface())
+			if ac.acPool.debugMode {
+				warnHeapFields(ac.acPool.Logger, t)
+			}
+		}
+	}
+	return r.Elem()
+}
+
+// NewScoped is same as New but also returns a closure reclaiming the object via FreeLast, e.g.
+//
+//	obj, free := lac.NewScoped[T](ac)
+//	defer free()
+//
+// The memory is only reclaimed if nothing was allocated after obj, otherwise it lives until reset.
+// Calling free more than once is no-op, and it's no-op when checking pointers since the checker tracks obj.
+func NewScoped[T any](ac *Allocator) (*T, func()) {
+	r := New[T](ac)
+	if ac == nil || ac.acPool.scanObjects() {
+		return r, func() {}
+	}
+	freed := false
+	return r, func() {
+		if !freed {
+			freed = true
+			ac.FreeLast(unsafe.Pointer(r), int(unsafe.Sizeof(*r)))
+		}
+	}
+}
+
+// NewInit allocates a zeroed object and initializes it by init, readable like NewFrom
+// but without the heap allocation of src:
+//
+//	obj := lac.NewInit(ac, func(p *SomeData) {
+//		p.Field1 = Value1
+//		p.Field2 = Value2
+//	})
+func NewInit[T any](ac *Allocator, init func(*T)) *T {
+	r := New[T](ac)
+	init(r)
+	return r
+}
+
+// initializers of types registered by RegisterInit, copied on write.
+var typeInits atomic.Pointer[map[reflect.Type]func(unsafe.Pointer)]
+
+// RegisterInit makes New and NewReflect of T run init after zeroing, e.g. to set the sentinel ids,
+// including the heap objects when ac is nil. NewUninit and the elements of slices are not initialized.
+// Pass nil to unregister. Should be called on startup, e.g. in the init function of the package.
+func RegisterInit[T any](init func(*T)) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	for {
+		old := typeInits.Load()
+		m := map[reflect.Type]func(unsafe.Pointer){}
+		if old != nil {
+			for k, v := range *old {
+				m[k] = v
+			}
+		}
+		if init != nil {
+			m[t] = func(p unsafe.Pointer) { init((*T)(p)) }
+		} else {
+			delete(m, t)
+		}
+		// nil keeps the fast path of New after the last one is unregistered.
+		next := &m
+		if len(m) == 0 {
+			next = nil
+		}
+		if typeInits.CompareAndSwap(old, next) {
+			return
+		}
+	}
+}
+
+// runTypeInit is no-op if nothing registered, keeping the fast path of New.
+func runTypeInit[T any](r *T) {
+	if typeInits.Load() != nil {
+		runTypeInitReflect(reflect.TypeOf(r).Elem(), unsafe.Pointer(r))
+	}
+}
+
+func runTypeInitReflect(t reflect.Type, p unsafe.Pointer) {
+	if m := typeInits.Load(); m != nil {
+		if f := (*m)[t]; f != nil {
+			f(p)
+		}
+	}
+}
+
 // NewFrom copy the src object from heap to lac thus slower than New due to the heap malloc of src.
 // **Prefer using New for better performance**.
 // It is useful for old-code migration using struct literal syntax:
@@ -122,7 +484,7 @@ func NewFrom[T any](ac *Allocator, src *T) *T {
 		// we should not use `noescape` to avoid heap alloc the src here,
 		// because it will cause all sub fields of src be stack allocated,
 		// and the memmove only copy the top level fields,
-		// therefor cause all sub pointer fields become dangled.
+		// therefor cause all sub pointer fields become dangled, reported as stack pointers in debug mode.
 		return src
 	}
 
@@ -131,7 +493,7 @@ func NewFrom[T any](ac *Allocator, src *T) *T {
 	ret := (*T)(ac.alloc(int(sz), false))
 	memmoveNoHeapPointers(unsafe.Pointer(ret), unsafe.Pointer(src), sz)
 
-	if ac.acPool.debugMode {
+	if ac.acPool.scanObjects() {
 		if reflect.TypeOf(ret).Elem().Kind() == reflect.Struct {
 			ac.debugScan(ret)
 		}
@@ -139,9 +501,50 @@ func NewFrom[T any](ac *Allocator, src *T) *T {
 	return ret
 }
 
-// NewSlice does not zero the slice automatically, this is OK with most cases and can improve the performance.
-// zero it yourself for your need.
-func NewSlice[T any](ac *Allocator, len, cap int) (r []T) {
+type reusableObj struct {
+	obj   any
+	reset func()
+}
+
+// Reusable returns the object of key cached by ac, which survives resets and is zeroed on each reset,
+// so a fixed per-request scaffold is allocated only once per Allocator of the pool.
+// The object lives out of the chunks and is kept alive by ac.
+// Not thread-safe, must be called before sharing ac with other goroutines.
+func Reusable[T any](ac *Allocator, key string) *T {
+	if ac == nil {
+		return new(T)
+	}
+	o, ok := ac.reusables[key]
+	if !ok {
+		if ac.reusables == nil {
+			ac.reusables = map[string]reusableObj{}
+		}
+		p := new(T)
+		o = reusableObj{obj: p, reset: func() {
+			var zero T
+			*p = zero
+		}}
+		ac.reusables[key] = o
+	}
+	r, ok := o.obj.(*T)
+	if !ok {
+		panic(fmt.Errorf("lac.Reusable: key %q is used by type %T", key, o.obj))
+	}
+	// the externals are cleared on reset.
+	ac.keepAlive(r)
+	return r
+}
+
+// NewSlice is same as NewSliceUninit: the elements of scalar types(bool, numbers, etc.) are uninitialized
+// and may contain the data of previous cycles, others are zeroed because they may contain pointers.
+// Use AllocObjects if zeroed elements are always required.
+func NewSlice[T any](ac *Allocator, len, cap int) []T {
+	return NewSliceUninit[T](ac, len, cap)
+}
+
+// NewSliceUninit does not zero the slice if not necessary, this is OK with most cases and can improve the performance.
+// zero it yourself for your need. Only the elements of types may contain pointers are zeroed to keep the GC safe.
+func NewSliceUninit[T any](ac *Allocator, len, cap int) (r []T) {
 	if ac == nil {
 		return make([]T, len, cap)
 	}
@@ -151,10 +554,9 @@ func NewSlice[T any](ac *Allocator, len, cap int) (r []T) {
 		panic("NewSlice: cap out of range")
 	}
 
-	if BugfixCorruptOtherMem {
-		if cap == 0 {
-			return nil
-		}
+	// no need to touch the chunks.
+	if cap == 0 {
+		return nil
 	}
 
 	slice := (*sliceHeader)(unsafe.Pointer(&r))
@@ -164,68 +566,431 @@ func NewSlice[T any](ac *Allocator, len, cap int) (r []T) {
 	if !BugfixClearPointerInMem {
 		zero = false
 	}
-	slice.Data = ac.alloc(cap*int(unsafe.Sizeof(t)), zero)
-	slice.Len = int64(len)
-	slice.Cap = int64(cap)
+	slice.Data = ac.alloc(cap*int(unsafe.Sizeof(*t)), zero)
+	slice.Len = len
+	slice.Cap = cap
+	if ac.acPool.debugMode {
+		ac.stampSlice(slice.Data)
+	}
 	return r
 }
 
-func Append[T any](ac *Allocator, s []T, elems ...T) []T {
+// AllocObjects allocates n zeroed and contiguous objects,
+// &r[i] is a valid Lac pointer which can be stored in other Lac objects, same as the one from New.
+func AllocObjects[T any](ac *Allocator, n int) (r []T) {
 	if ac == nil {
-		return append(s, elems...)
+		return make([]T, n)
 	}
+	if n == 0 {
+		return nil
+	}
+	var t T
+	h := (*sliceHeader)(unsafe.Pointer(&r))
+	h.Data = ac.alloc(n*int(unsafe.Sizeof(t)), true)
+	h.Len = n
+	h.Cap = n
+	return
+}
 
-	if len(elems) == 0 {
-		return s
+// NewPtrSliceInit allocates n zeroed contiguous objects and the slice of pointers to them,
+// then calls init for each if not nil. Two allocations in total instead of growing the slice by Append:
+//
+//	d.Items = lac.NewPtrSliceInit(ac, n, func(i int, p *Item) {
+//		p.Id = ac.Int(i)
+//	})
+func NewPtrSliceInit[T any](ac *Allocator, n int, init func(i int, p *T)) []*T {
+	r := NewSlice[*T](ac, n, n)
+	FillPtrs(ac, r)
+	if init != nil {
+		for i, p := range r {
+			init(i, p)
+		}
+	}
+	return r
+}
+
+// FillPtrs points each element of dst to the zeroed objects allocated contiguously in one allocation,
+// e.g. the elements of an array field:
+//
+//	lac.FillPtrs(ac, obj.Slots[:])
+func FillPtrs[T any](ac *Allocator, dst []*T) {
+	objs := AllocObjects[T](ac, len(dst))
+	for i := range objs {
+		dst[i] = &objs[i]
 	}
+}
 
-	h := (*sliceHeader)(unsafe.Pointer(&s))
-	elemSz := int(unsafe.Sizeof(elems[0]))
+// Scoped allocates a zeroed scratch slice of n elements for the duration of fn,
+// the memory is reclaimed immediately after fn returns if no new chunk is started during fn,
+// otherwise it's reclaimed on reset as usual. There is no general checkpoint support in this package.
+// The slice and all objects allocated in fn must not be retained after fn returns.
+// Only reclaims in single-threaded mode, and never when checking pointers since the checker tracks the objects.
+func Scoped[T any](ac *Allocator, n int, fn func([]T)) {
+	if ac == nil {
+		fn(make([]T, n))
+		return
+	}
+
+	var cur unsafe.Pointer
+	var mark int
+	single := ac.refCnt.Load() == 1 && !ac.acPool.scanObjects()
+	if single && ac.curChunk != nil {
+		cur = ac.curChunk
+		mark = (*sliceHeader)(cur).Len
+	}
+	requested := ac.requested
 
-	// grow
-	if h.Len >= h.Cap {
-		pre := *h
-
-		cur := float64(h.Cap)
-		h.Cap = max(int64(cur*SliceExtendRatio), pre.Cap+int64(len(elems)))
-		// prefer to fit in a normal chunk.
-		if h.Cap > int64(ac.acPool.chunkPool.ChunkSize) && SliceExtendRatio > 1.5 {
-			small := int64(cur * 1.5)
-			if small > pre.Cap+int64(len(elems)) {
-				h.Cap = small
+	fn(AllocObjects[T](ac, n))
+
+	if single && cur != nil && ac.curChunk == cur {
+		(*sliceHeader)(cur).Len = mark
+		ac.requested = requested
+	}
+}
+
+// NewSlicePtr allocates both the slice header and the backing array from ac,
+// useful for passing a mutable slice reference through the lac allocated structures.
+func NewSlicePtr[T any](ac *Allocator, len, cap int) *[]T {
+	r := New[[]T](ac)
+	*r = NewSlice[T](ac, len, cap)
+	return r
+}
+
+// NewAnySlice copies vals into a slice allocated from ac, and keeps the data of each element alive,
+// so the heap objects can be stored without Attach one by one.
+// Assign the elements by NewAnySlice or Attach afterwards, they are checked in debug mode.
+func NewAnySlice(ac *Allocator, vals []any) []any {
+	r := NewSlice[any](ac, len(vals), len(vals))
+	for i, v := range vals {
+		if ac != nil {
+			if d := data(v); d != nil {
+				ac.externalPtr.Put(d)
 			}
 		}
+		r[i] = v
+	}
+	return r
+}
 
-		if h.Cap < 16 {
-			h.Cap = 16
+// NewSliceFilled allocates a slice of n elements all set to val.
+func NewSliceFilled[T any](ac *Allocator, n int, val T) []T {
+	s := NewSliceUninit[T](ac, n, n)
+	if n == 0 {
+		return s
+	}
+	// fill by doubling the filled part, as fast as memset.
+	s[0] = val
+	for i := 1; i < n; i *= 2 {
+		copy(s[i:], s[:i])
+	}
+	return s
+}
+
+// NewSliceFit allocates a slice of len elements with the cap extended to the rest space of the current chunk,
+// so the following Append can grow in place instead of wasting the rest and starting a new chunk.
+// The cap is len if the current chunk can't hold it.
+func NewSliceFit[T any](ac *Allocator, len int) []T {
+	var t T
+	if sz := int(unsafe.Sizeof(t)); sz > 0 {
+		if n := ac.CurrentChunkFree() / sz; n > len {
+			return NewSlice[T](ac, len, n)
 		}
+	}
+	return NewSlice[T](ac, len, len)
+}
 
-		sz := int(h.Cap) * elemSz
-		h.Data = ac.alloc(sz, false)
-		memmoveNoHeapPointers(h.Data, pre.Data, uintptr(int(pre.Len)*elemSz))
+// SliceOverBytes reinterprets b as []T sharing the same memory, e.g. typed views over the bytes from NewSlice[byte].
+// Both slices alias each other, T must be pointer-free because the GC never scans the bytes,
+// and b must be aligned for T. Panics if len(b) is not multiple of the size of T.
+func SliceOverBytes[T any](b []byte) (r []T) {
+	var t T
+	sz := int(unsafe.Sizeof(t))
+	if sz == 0 || len(b)%sz != 0 {
+		panic(fmt.Errorf("lac.SliceOverBytes: len %v is not multiple of sizeof(%T) %v", len(b), t, sz))
+	}
+	if b == nil {
+		return nil
+	}
+	src := (*sliceHeader)(unsafe.Pointer(&b))
+	h := (*sliceHeader)(unsafe.Pointer(&r))
+	h.Data = src.Data
+	h.Len = src.Len / sz
+	h.Cap = src.Cap / sz
+	return
+}
 
-		// clear the reset part
+// SliceFromScratch carves a zeroed []T of n elements from the front of scratch without touching any allocator,
+// returns the slice and the rest of scratch for the following carving. The start is aligned for T.
+// Same as SliceOverBytes, T must be pointer-free. Panics if scratch is too small.
+func SliceFromScratch[T any](scratch []byte, n int) ([]T, []byte) {
+	var t T
+	sz, align := int(unsafe.Sizeof(t)), int(unsafe.Alignof(t))
+	pad := 0
+	if len(scratch) > 0 {
+		addr := uintptr(unsafe.Pointer(&scratch[0]))
+		pad = int((uintptr(align) - addr%uintptr(align)) % uintptr(align))
+	}
+	need := pad + sz*n
+	if n < 0 || need > len(scratch) {
+		panic(fmt.Errorf("lac.SliceFromScratch: need %v bytes for %v %T, got %v", need, n, t, len(scratch)))
+	}
+	if n == 0 {
+		return nil, scratch
+	}
+	b := scratch[pad:need]
+	for i := range b {
+		b[i] = 0
+	}
+
+	var r []T
+	h := (*sliceHeader)(unsafe.Pointer(&r))
+	h.Data = unsafe.Pointer(&b[0])
+	h.Len = n
+	h.Cap = n
+	return r, scratch[need:]
+}
 
+// MakeSlice is same as NewSlice, named after the experimental arena package,
+// so the code using arena.MakeSlice can be migrated by switching the import.
+func MakeSlice[T any](ac *Allocator, len, cap int) []T {
+	return NewSlice[T](ac, len, cap)
+}
+
+// NewValue is same as New, for the migration from the experimental arena package, see MakeSlice.
+func NewValue[T any](ac *Allocator) *T {
+	return New[T](ac)
+}
+
+// MakeSliceExact allocates an empty slice with exactly cap capacity,
+// the following Append will not reallocate until exceeding cap.
+func MakeSliceExact[T any](ac *Allocator, cap int) []T {
+	return NewSlice[T](ac, 0, cap)
+}
+
+// TrimToLen returns s with cap equal to len by copying it into a new tight backing array,
+// useful to reclaim the over-allocation of the Append for long-lived slices.
+// No-op if the slack is no more than a quarter of len.
+func TrimToLen[T any](ac *Allocator, s []T) []T {
+	if cap(s)-len(s) <= len(s)/4 {
+		return s
+	}
+	if len(s) == 0 {
+		return s[:0:0]
+	}
+	r := NewSliceUninit[T](ac, len(s), len(s))
+	copy(r, s)
+	return r
+}
+
+func Append[T any](ac *Allocator, s []T, elems ...T) []T {
+	if ac == nil {
+		return append(s, elems...)
+	}
+
+	if len(elems) == 0 {
+		return s
+	}
+
+	h := (*sliceHeader)(unsafe.Pointer(&s))
+	elemSz := int(unsafe.Sizeof(elems[0]))
+
+	if ac.acPool.debugMode && h.Len > 0 {
+		ac.checkAppendBacking(h.Data, s)
+	}
+
+	if h.Len+len(elems) > h.Cap {
 		// FIX: invalid pointer in the allocated memory may cause panic in the write barrier.
 		var t *T
 		zero := mayContainsPtr(reflect.TypeOf(t).Elem().Kind())
 		if !BugfixClearPointerInMem {
 			zero = false
 		}
-		if zero {
-			used := elemSz * int(pre.Len)
-			memclrNoHeapPointers(unsafe.Add(h.Data, used), uintptr(sz-used))
-		}
+		ac.growSlice(h, elemSz, len(elems), zero)
 	}
 
 	// append
 	src := (*sliceHeader)(unsafe.Pointer(&elems))
-	memmoveNoHeapPointers(unsafe.Add(h.Data, elemSz*int(h.Len)), src.Data, uintptr(elemSz*int(src.Len)))
+	memmoveNoHeapPointers(unsafe.Add(h.Data, elemSz*h.Len), src.Data, uintptr(elemSz*src.Len))
 	h.Len += src.Len
 
 	return s
 }
 
+// Flatten concatenates the slices in s into one contiguous slice.
+// Pointers in the elements are copied as-is, the external memories referenced by them are attached to ac.
+func Flatten[T any](ac *Allocator, s [][]T) []T {
+	total := 0
+	for _, i := range s {
+		total += len(i)
+	}
+	if ac == nil {
+		r := make([]T, 0, total)
+		for _, i := range s {
+			r = append(r, i...)
+		}
+		return r
+	}
+
+	r := NewSlice[T](ac, total, total)
+	if total == 0 {
+		return r
+	}
+	var t T
+	elemSz := uintptr(unsafe.Sizeof(t))
+	dst := (*sliceHeader)(unsafe.Pointer(&r)).Data
+	for _, i := range s {
+		if len(i) == 0 {
+			continue
+		}
+		// safe to bypass the write barrier, the pointers are kept alive by s until attached below.
+		src := (*sliceHeader)(unsafe.Pointer(&i))
+		memmoveNoHeapPointers(dst, src.Data, uintptr(len(i))*elemSz)
+		dst = unsafe.Add(dst, uintptr(len(i))*elemSz)
+	}
+
+	if mayContainsPtr(typeKind[T]()) {
+		// the elements may come from the heap, the GC doesn't scan the Lac memory.
+		c := &cloneCtx{dst: ac}
+		v := reflect.ValueOf(r)
+		for j := 0; j < total; j++ {
+			c.attachFields(v.Index(j))
+		}
+		c.flushExternals()
+		runtime.KeepAlive(s)
+	}
+	return r
+}
+
+// SetAt writes v at index i of s, extends len of s to i+1 if needed, the gap is zeroed.
+// Panics if i is out of cap. ac is not used since s is never grown,
+// it keeps the same signature as Append for switching between them.
+func SetAt[T any](ac *Allocator, s []T, i int, v T) []T {
+	if i < 0 || i >= cap(s) {
+		panic(fmt.Errorf("lac.SetAt: index %v out of cap %v", i, cap(s)))
+	}
+	if l := len(s); i >= l {
+		s = s[:i+1]
+		if mayContainsPtr(typeKind[T]()) {
+			// s may be from the heap, keep the write barrier.
+			// the pointers beyond len are valid or nil, the Lac memory of them is zeroed on allocation.
+			var zero T
+			for j := l; j < i; j++ {
+				s[j] = zero
+			}
+		} else {
+			// memory beyond len may be dirty.
+			memclrNoHeapPointers(unsafe.Pointer(&s[l]), uintptr(i-l)*unsafe.Sizeof(v))
+		}
+	}
+	s[i] = v
+	return s
+}
+
+// AppendUnique appends v only if it is not in s, for small set-like slices in linear scanning.
+func AppendUnique[T comparable](ac *Allocator, s []T, v T) []T {
+	for _, i := range s {
+		if i == v {
+			return s
+		}
+	}
+	return Append(ac, s, v)
+}
+
+// checkAppendBacking reports the non-empty backing array not from ac,
+// the result of Append diverges from it after growing and the heap backing is not tracked.
+func (ac *Allocator) checkAppendBacking(data unsafe.Pointer, s any) {
+	if ac.checkPointerType(uintptr(data)) == pointerTypeLacInternal {
+		return
+	}
+	ac.externalSlice.Lock()
+	defer ac.externalSlice.Unlock()
+	for _, i := range ac.externalSlice.slice {
+		if i == data {
+			return
+		}
+	}
+	errorf(ac.acPool.Logger, "lac.Append: backing array of %T is not from Lac#%d, use NewSlice or AttachSlice", s, ac.id)
+}
+
+// growSlice reallocates the slice to hold at least n more elements.
+func (ac *Allocator) growSlice(h *sliceHeader, elemSz, n int, zero bool) {
+	pre := *h
+
+	cur := float64(h.Cap)
+	h.Cap = max(int(cur*SliceExtendRatio), pre.Len+n)
+	// prefer to fit in a normal chunk.
+	if h.Cap > ac.acPool.chunkPool.ChunkSize && SliceExtendRatio > 1.5 {
+		small := int(cur * 1.5)
+		if small > pre.Len+n {
+			h.Cap = small
+		}
+	}
+
+	if h.Cap < 16 {
+		h.Cap = 16
+	}
+
+	// int64 to not overflow on 32bit platforms.
+	if int64(h.Cap)*int64(elemSz) > int64(MaxAllocBytes) {
+		need := pre.Len + n
+		h.Cap = max(MaxAllocBytes/elemSz, need)
+		if h.Cap <= pre.Cap {
+			h.Cap = max(pre.Cap+SliceGrowStep/elemSz, need)
+		}
+	}
+
+	sz := h.Cap * elemSz
+	h.Data = ac.alloc(sz, false)
+	memmoveNoHeapPointers(h.Data, pre.Data, uintptr(pre.Len*elemSz))
+
+	// clear the reset part
+	if zero {
+		used := elemSz * pre.Len
+		memclrNoHeapPointers(unsafe.Add(h.Data, used), uintptr(sz-used))
+	}
+}
+
+// AppendBytes is the specialized version of Append for byte buffers.
+func (ac *Allocator) AppendBytes(dst, src []byte) []byte {
+	if ac == nil {
+		return append(dst, src...)
+	}
+	if len(src) == 0 {
+		return dst
+	}
+
+	h := (*sliceHeader)(unsafe.Pointer(&dst))
+	if h.Len+len(src) > h.Cap {
+		ac.growSlice(h, 1, len(src), false)
+	}
+	s := (*sliceHeader)(unsafe.Pointer(&src))
+	memmoveNoHeapPointers(unsafe.Add(h.Data, h.Len), s.Data, uintptr(s.Len))
+	h.Len += s.Len
+	return dst
+}
+
+// AppendString appends the bytes of s to the byte buffer.
+func (ac *Allocator) AppendString(dst []byte, s string) []byte {
+	if ac == nil {
+		return append(dst, s...)
+	}
+	if len(s) == 0 {
+		return dst
+	}
+
+	h := (*sliceHeader)(unsafe.Pointer(&dst))
+	if h.Len+len(s) > h.Cap {
+		ac.growSlice(h, 1, len(s), false)
+	}
+	sh := (*stringHeader)(unsafe.Pointer(&s))
+	memmoveNoHeapPointers(unsafe.Add(h.Data, h.Len), sh.Data, uintptr(sh.Len))
+	h.Len += sh.Len
+	return dst
+}
+
+// NewMap creates a map from the heap and keeps it alive, so it can be referenced by Lac objects.
+// Values stored in the map are scanned by the GC, so nested maps in it need not to be attached,
+// only the maps referenced solely by Lac objects require NewMap or Attach.
 func NewMap[K comparable, V any](ac *Allocator, cap int) map[K]V {
 	m := make(map[K]V, cap)
 	if ac == nil {
@@ -254,6 +1019,10 @@ func (ac *Allocator) NewString(v string) string {
 		return ""
 	}
 	h := (*stringHeader)(unsafe.Pointer(&v))
+	// chunks is only stable in single-threaded mode.
+	if NewStringReuseInternal && ac.refCnt.Load() == 1 && ac.checkPointerType(uintptr(h.Data)) == pointerTypeLacInternal {
+		return v
+	}
 	ptr := ac.alloc(h.Len, false)
 	if ptr != nil {
 		memmoveNoHeapPointers(ptr, h.Data, uintptr(h.Len))
@@ -262,6 +1031,21 @@ func (ac *Allocator) NewString(v string) string {
 	return v
 }
 
+// Itoa formats i in base 10 into ac without heap allocation, e.g. for the structured logging.
+// The returned string becomes invalid after ac is released.
+func (ac *Allocator) Itoa(i int64) (r string) {
+	if ac == nil {
+		return strconv.FormatInt(i, 10)
+	}
+	var buf [20]byte
+	b := strconv.AppendInt(buf[:0], i, 10)
+	h := (*stringHeader)(unsafe.Pointer(&r))
+	h.Data = ac.alloc(len(b), false)
+	h.Len = len(b)
+	memmoveNoHeapPointers(h.Data, unsafe.Pointer(&b[0]), uintptr(len(b)))
+	return
+}
+
 // Attach mark ptr as external pointer and will keep ptr alive during GC,
 // otherwise the ptr from heap may be GCed and cause a dangled pointer, no panic will report by the runtime.
 // So make sure to mark objects from native heap as external pointers by using this function.
@@ -276,6 +1060,8 @@ func (ac *Allocator) NewString(v string) string {
 //	obj.Field = lac.Attach(ac, externalPtr)
 //
 // ```
+//
+// unsafe.Pointer fields holding heap data must be attached too since the chunks are not scanned by the GC.
 func Attach[T any](ac *Allocator, ptr T) T {
 	if ac == nil {
 		return ptr
@@ -284,6 +1070,18 @@ func Attach[T any](ac *Allocator, ptr T) T {
 	return ptr
 }
 
+// AttachSlice is the slice version of Attach without copying,
+// useful for zero-copy referencing memories owned elsewhere, e.g. a buffer of mmaped file.
+func AttachSlice[T any](ac *Allocator, data []T) []T {
+	if ac == nil {
+		return data
+	}
+	if h := (*sliceHeader)(unsafe.Pointer(&data)); h.Data != nil {
+		ac.externalSlice.Put(h.Data)
+	}
+	return data
+}
+
 //============================================================================
 // Protobuf2 APIs
 //============================================================================
@@ -308,6 +1106,26 @@ func (ac *Allocator) Int(v int) (r *int) {
 	return
 }
 
+// Ints allocates vals contiguously in one block and returns the pointers to each of them,
+// e.g. wiring the scalar fields of a decoded message with a single allocation instead of one per field.
+func (ac *Allocator) Ints(vals ...int) []*int {
+	if len(vals) == 0 {
+		return nil
+	}
+	var block []int
+	if ac == nil {
+		block = append(block, vals...)
+	} else {
+		block = NewSlice[int](ac, len(vals), len(vals))
+		copy(block, vals)
+	}
+	r := NewSlice[*int](ac, len(vals), len(vals))
+	for i := range block {
+		r[i] = &block[i]
+	}
+	return r
+}
+
 func (ac *Allocator) Int32(v int32) (r *int32) {
 	if ac == nil {
 		r = new(int32)
@@ -368,6 +1186,26 @@ func (ac *Allocator) Float64(v float64) (r *float64) {
 	return
 }
 
+func (ac *Allocator) Complex64(v complex64) (r *complex64) {
+	if ac == nil {
+		r = new(complex64)
+	} else {
+		r = (*complex64)(ac.alloc(int(unsafe.Sizeof(v)), false))
+	}
+	*r = v
+	return
+}
+
+func (ac *Allocator) Complex128(v complex128) (r *complex128) {
+	if ac == nil {
+		r = new(complex128)
+	} else {
+		r = (*complex128)(ac.alloc(int(unsafe.Sizeof(v)), false))
+	}
+	*r = v
+	return
+}
+
 func (ac *Allocator) String(v string) (r *string) {
 	if ac == nil {
 		r = new(string)
@@ -377,7 +1215,91 @@ func (ac *Allocator) String(v string) (r *string) {
 		const zero = true
 
 		r = (*string)(ac.alloc(int(unsafe.Sizeof(v)), zero))
-		*r = ac.NewString(v)
+		// already zeroed.
+		if v != "" {
+			*r = ac.NewString(v)
+		}
 	}
 	return
 }
+
+// StringPtrFrom copies both the slot and the data of src into Lac, e.g. migrating the *string fields
+// of heap objects. nil src returns nil.
+func (ac *Allocator) StringPtrFrom(src *string) *string {
+	if ac == nil || src == nil {
+		return src
+	}
+	return ac.String(*src)
+}
+
+// TimeSlice copies ts into Lac and keeps the locations of the elements alive.
+func (ac *Allocator) TimeSlice(ts []time.Time) []time.Time {
+	if ac == nil {
+		return append([]time.Time(nil), ts...)
+	}
+	r := NewSlice[time.Time](ac, len(ts), len(ts))
+	if len(ts) == 0 {
+		return r
+	}
+
+	// most of them share the same location.
+	var locs []*time.Location
+	for i := range ts {
+		loc := ts[i].Location()
+		found := false
+		for _, l := range locs {
+			if l == loc {
+				found = true
+				break
+			}
+		}
+		if !found {
+			locs = append(locs, loc)
+			ac.keepAlive(loc)
+		}
+	}
+
+	// safe to bypass the write barrier, the locations are kept alive.
+	memmoveNoHeapPointers((*sliceHeader)(unsafe.Pointer(&r)).Data, (*sliceHeader)(unsafe.Pointer(&ts)).Data,
+		uintptr(len(ts))*unsafe.Sizeof(ts[0]))
+	return r
+}
+
+func scalarSlice[T any](ac *Allocator, vals []T) []T {
+	r := NewSliceUninit[T](ac, len(vals), len(vals))
+	copy(r, vals)
+	return r
+}
+
+// BoolSlice allocates a copy of vals in one shot, useful for repeated fields.
+func (ac *Allocator) BoolSlice(vals ...bool) []bool {
+	return scalarSlice(ac, vals)
+}
+
+func (ac *Allocator) IntSlice(vals ...int) []int {
+	return scalarSlice(ac, vals)
+}
+
+func (ac *Allocator) Int32Slice(vals ...int32) []int32 {
+	return scalarSlice(ac, vals)
+}
+
+func (ac *Allocator) Uint32Slice(vals ...uint32) []uint32 {
+	return scalarSlice(ac, vals)
+}
+
+func (ac *Allocator) Int64Slice(vals ...int64) []int64 {
+	return scalarSlice(ac, vals)
+}
+
+func (ac *Allocator) Uint64Slice(vals ...uint64) []uint64 {
+	return scalarSlice(ac, vals)
+}
+
+func (ac *Allocator) Float32Slice(vals ...float32) []float32 {
+	return scalarSlice(ac, vals)
+}
+
+func (ac *Allocator) Float64Slice(vals ...float64) []float64 {
+	return scalarSlice(ac, vals)
+}
@@ -13,7 +13,10 @@ import (
 	"flag"
 	"fmt"
 	"runtime"
+	"sort"
+	"sync"
 	"testing"
+	"time"
 )
 
 type PbItemEx struct {
@@ -68,6 +71,11 @@ type PbDataEx struct {
 
 var makeItemAc = func(j int, ac *Allocator) *PbItemEx {
 	r := New[PbItemEx](ac)
+	fillItemAc(j, ac, r)
+	return r
+}
+
+func fillItemAc(j int, ac *Allocator, r *PbItemEx) {
 	r.Id1 = ac.Int(2 + j)
 	r.Id2 = ac.Int(2 + j)
 	r.Id3 = ac.Int(2 + j)
@@ -83,7 +91,6 @@ var makeItemAc = func(j int, ac *Allocator) *PbItemEx {
 	r.Name1 = ac.String("name")
 	r.Active = ac.Bool(true)
 	r.EnumVal = NewEnum(ac, EnumVal2)
-	return r
 }
 
 var itemLoop = 10
@@ -168,6 +175,19 @@ func BenchmarkNewFrom(b *testing.B) {
 	runtime.KeepAlive(item)
 }
 
+func BenchmarkNewInit(b *testing.B) {
+	ac := acPool.Get()
+	defer ac.Release()
+
+	var item *PbItem
+	for i := 0; i < b.N; i++ {
+		item = NewInit(ac, func(p *PbItem) {
+			p.Id = ac.Int(i)
+		})
+	}
+	runtime.KeepAlive(item)
+}
+
 func Benchmark_RawMalloc(t *testing.B) {
 
 	t.ResetTimer()
@@ -236,6 +256,79 @@ func Benchmark_LacMallocMt(t *testing.B) {
 	t.StopTimer()
 }
 
+// Benchmark_LacMallocShared measures the scalability of the multi-thread path,
+// all goroutines share one allocator, compare the sub-benchmarks with benchstat.
+func Benchmark_LacMallocShared(b *testing.B) {
+	acPool.EnableDebugMode(false)
+
+	for _, n := range []int{1, 2, 4, 8, 16} {
+		b.Run(fmt.Sprintf("goroutines=%d", n), func(b *testing.B) {
+			ac := acPool.Get()
+			ac.IncRef()
+			defer ac.Release()
+
+			// exactly n goroutines.
+			defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(n))
+			b.SetParallelism(1)
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				var e *PbItem
+				i := 0
+				for pb.Next() {
+					e = New[PbItem](ac)
+					e.Name = ac.String("a")
+					e.Class = ac.Int(i)
+					e.Id = ac.Int(i + 10)
+					e.Active = ac.Bool(true)
+					i++
+				}
+				runtime.KeepAlive(e)
+			})
+			b.StopTimer()
+		})
+	}
+}
+
+// Benchmark_LacMallocSharedP99 reports the p99 latency of the allocations on a shared allocator,
+// compare fair=false and fair=true to see the effect of FairAlloc.
+func Benchmark_LacMallocSharedP99(b *testing.B) {
+	for _, fair := range []bool{false, true} {
+		b.Run(fmt.Sprintf("fair=%v", fair), func(b *testing.B) {
+			p := NewAllocatorPool("p99", nil, 1, 64*1024, 0, 0)
+			p.FairAlloc = fair
+			ac := p.Get()
+			ac.IncRef()
+			defer ac.Release()
+
+			var lock sync.Mutex
+			var all []time.Duration
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				var lat []time.Duration
+				var e *PbItem
+				for pb.Next() {
+					start := time.Now()
+					e = New[PbItem](ac)
+					e.Id = ac.Int(1)
+					lat = append(lat, time.Since(start))
+				}
+				runtime.KeepAlive(e)
+				lock.Lock()
+				all = append(all, lat...)
+				lock.Unlock()
+			})
+			b.StopTimer()
+
+			sort.Slice(all, func(i, j int) bool { return all[i] < all[j] })
+			if len(all) > 0 {
+				b.ReportMetric(float64(all[len(all)*99/100].Nanoseconds()), "p99-ns")
+			}
+		})
+	}
+}
+
 func Benchmark_RawMallocLarge2(t *testing.B) {
 	t.ResetTimer()
 	var e *PbDataEx
@@ -281,3 +374,199 @@ func Benchmark_LacMallocLarge2Mt(t *testing.B) {
 	runtime.KeepAlive(e)
 	t.StopTimer()
 }
+
+const gcMapSize = 100000
+
+func Benchmark_RawMapGC(b *testing.B) {
+	m := make(map[int]*PbItem, gcMapSize)
+	for i := 0; i < gcMapSize; i++ {
+		m[i] = new(PbItem)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		runtime.GC()
+	}
+	runtime.KeepAlive(m)
+}
+
+func Benchmark_LacMapGC(b *testing.B) {
+	acPool.EnableDebugMode(false)
+	ac := acPool.Get()
+	defer ac.Release()
+
+	m := NewLacMap[int, *PbItem](ac, gcMapSize)
+	for i := 0; i < gcMapSize; i++ {
+		m.Set(i, New[PbItem](ac))
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		runtime.GC()
+	}
+	runtime.KeepAlive(m)
+}
+
+func benchNewItemEx(b *testing.B, newItem func(ac *Allocator) *PbItemEx) {
+	acPool.EnableDebugMode(false)
+	ac := acPool.Get()
+	var e *PbItemEx
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// restart periodically to reuse the dirty memory.
+		if i%1024 == 1023 {
+			ac.Release()
+			ac = acPool.Get()
+		}
+		e = newItem(ac)
+		// set all the fields.
+		*e = PbItemEx{}
+	}
+	b.StopTimer()
+	runtime.KeepAlive(e)
+	ac.Release()
+}
+
+func Benchmark_NewItemEx(b *testing.B) {
+	benchNewItemEx(b, New[PbItemEx])
+}
+
+func Benchmark_NewUninitItemEx(b *testing.B) {
+	benchNewItemEx(b, NewUninit[PbItemEx])
+}
+
+func Benchmark_IntFields(b *testing.B) {
+	benchNewItemEx(b, func(ac *Allocator) *PbItemEx {
+		e := New[PbItemEx](ac)
+		e.Id1, e.Id2, e.Id3, e.Id4, e.Id5 = ac.Int(1), ac.Int(2), ac.Int(3), ac.Int(4), ac.Int(5)
+		e.Id6, e.Id7, e.Id8, e.Id9, e.Id10 = ac.Int(6), ac.Int(7), ac.Int(8), ac.Int(9), ac.Int(10)
+		e.Price, e.Class = ac.Int(11), ac.Int(12)
+		return e
+	})
+}
+
+func Benchmark_IntsBatch(b *testing.B) {
+	benchNewItemEx(b, func(ac *Allocator) *PbItemEx {
+		e := New[PbItemEx](ac)
+		p := ac.Ints(1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12)
+		e.Id1, e.Id2, e.Id3, e.Id4, e.Id5 = p[0], p[1], p[2], p[3], p[4]
+		e.Id6, e.Id7, e.Id8, e.Id9, e.Id10 = p[5], p[6], p[7], p[8], p[9]
+		e.Price, e.Class = p[10], p[11]
+		return e
+	})
+}
+
+func benchItems(b *testing.B, makeItems func(ac *Allocator) []*PbItemEx) {
+	acPool.EnableDebugMode(false)
+	ac := acPool.Get()
+	var items []*PbItemEx
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if i%64 == 63 {
+			ac.Release()
+			ac = acPool.Get()
+		}
+		items = makeItems(ac)
+	}
+	b.StopTimer()
+	runtime.KeepAlive(items)
+	ac.Release()
+}
+
+func Benchmark_ItemsAppend(b *testing.B) {
+	benchItems(b, func(ac *Allocator) (items []*PbItemEx) {
+		for j := 0; j < itemLoop; j++ {
+			items = Append(ac, items, makeItemAc(j, ac))
+		}
+		return
+	})
+}
+
+func Benchmark_ItemsPtrSliceInit(b *testing.B) {
+	benchItems(b, func(ac *Allocator) []*PbItemEx {
+		return NewPtrSliceInit(ac, itemLoop, func(j int, p *PbItemEx) {
+			fillItemAc(j, ac, p)
+		})
+	})
+}
+
+// fat struct with all fields external.
+func Benchmark_MoveExternals(b *testing.B) {
+	acPool.EnableDebugMode(false)
+	src := acPool.Get()
+	defer src.Release()
+	obj := New[PbItemEx](src)
+	*obj = *makeItemAc(0, nil)
+
+	dst := acPool.Get()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if i%1024 == 1023 {
+			dst.Release()
+			dst = acPool.Get()
+		}
+		Move(dst, src, obj)
+	}
+	b.StopTimer()
+	dst.Release()
+}
+
+func benchChurn(b *testing.B, useFreeList bool) {
+	acPool.EnableDebugMode(false)
+	ac := acPool.Get()
+	f := NewFreeList[PbItem](ac)
+	used := 0
+	var items [16]*PbItem
+
+	for i := 0; i < b.N; i++ {
+		// restart periodically to bound the memory usage.
+		if i%1024 == 1023 {
+			for _, c := range ac.chunks {
+				used += int(c.Len)
+			}
+			ac.Release()
+			ac = acPool.Get()
+			f = NewFreeList[PbItem](ac)
+		}
+
+		for j := range items {
+			if useFreeList {
+				items[j] = f.GetOne()
+			} else {
+				items[j] = New[PbItem](ac)
+			}
+		}
+		if useFreeList {
+			for _, item := range items {
+				f.PutOne(item)
+			}
+		}
+	}
+	for _, c := range ac.chunks {
+		used += int(c.Len)
+	}
+	ac.Release()
+	b.ReportMetric(float64(used)/float64(b.N), "lac-B/op")
+}
+
+func Benchmark_ChurnNew(b *testing.B) {
+	benchChurn(b, false)
+}
+
+func Benchmark_ChurnFreeList(b *testing.B) {
+	benchChurn(b, true)
+}
+
+// Benchmark_GetRelease measures the per-request latency of a small workload without externals.
+func Benchmark_GetRelease(b *testing.B) {
+	acPool.EnableDebugMode(false)
+
+	for i := 0; i < b.N; i++ {
+		ac := acPool.Get()
+		e := New[PbItem](ac)
+		e.Id = ac.Int(i)
+		ac.Release()
+	}
+}
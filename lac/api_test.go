@@ -10,9 +10,14 @@
 package lac
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"os"
+	"reflect"
 	"runtime"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -92,281 +97,1488 @@ func Test_Alignment(t *testing.T) {
 	}
 }
 
-func Test_String(t *testing.T) {
+func Test_CurrentChunkFree(t *testing.T) {
 	ac := acPool.Get()
 	defer ac.Release()
 
-	type D struct {
-		s [5]*string
+	if ac.CurrentChunkFree() != 0 {
+		t.Errorf("no chunk yet")
 	}
-	d := New[D](ac)
-	for i := range d.s {
-		d.s[i] = ac.String(fmt.Sprintf("str%v", i))
-		runtime.GC()
+	ac.Int(1)
+	if n := ac.CurrentChunkFree(); n != acPool.chunkPool.ChunkSize-ptrSize {
+		t.Errorf("free: %v", n)
 	}
-	for i, p := range d.s {
-		if *p != fmt.Sprintf("str%v", i) {
-			t.Errorf("elem %v is gced", i)
-		}
+}
+
+func Test_AvailableWithoutGrowth(t *testing.T) {
+	p := NewAllocatorPool("available", nil, 1, 1024, 3, 0)
+	ac := p.Get()
+	defer ac.Release()
+
+	if n := ac.AvailableWithoutGrowth(); n != 3*1024 {
+		t.Errorf("available: %v", n)
+	}
+	ac.Int(1)
+	if n := ac.AvailableWithoutGrowth(); n != int64(1024-ptrSize+2*1024) {
+		t.Errorf("available: %v", n)
 	}
 }
 
-func Test_NewMap(t *testing.T) {
+func Test_FreeLast(t *testing.T) {
 	ac := acPool.Get()
 	defer ac.Release()
 
-	type D struct {
-		m map[int]*int
+	a := NewSlice[byte](ac, 13, 13)
+	free := ac.CurrentChunkFree()
+	b := NewSlice[byte](ac, 21, 21)
+	if ac.FreeLast(unsafe.Pointer(&a[0]), len(a)) {
+		t.Errorf("should not free in the middle")
 	}
-	data := [10]*D{}
-	for i := 0; i < len(data); i++ {
-		d := New[D](ac)
-		d.m = NewMap[int, *int](ac, 0)
-		d.m[1] = ac.Int(i)
-		data[i] = d
-		runtime.GC()
+	if !ac.FreeLast(unsafe.Pointer(&b[0]), len(b)) || ac.CurrentChunkFree() != free {
+		t.Errorf("failed to free the last")
 	}
-	for i, d := range data {
-		if *d.m[1] != i {
-			t.Fail()
-		}
+	if c := NewSlice[byte](ac, 8, 8); &c[0] != &b[0] {
+		t.Errorf("memory not reused")
 	}
 }
 
-func Test_NewSlice(t *testing.T) {
-	acPool.EnableDebugMode(true)
-	ac := acPool.Get()
+func Test_NewScoped(t *testing.T) {
+	p := NewAllocatorPool("scoped", nil, 1, 1024, 0, 0)
+	ac := p.Get()
 	defer ac.Release()
 
-	s := make([]*int, 0)
-	s = Append(ac, s, ac.Int(2))
-	if len(s) != 1 && *s[0] != 2 {
-		t.Fail()
+	free := ac.CurrentChunkFree()
+	func() {
+		obj, release := NewScoped[PbItem](ac)
+		defer release()
+		obj.Id = ac.Int(1)
+		// not the last one.
+		release()
+	}()
+	if ac.CurrentChunkFree() == free {
+		t.Errorf("should not be reclaimed")
 	}
 
-	s = NewSlice[*int](ac, 0, 32)
-	s = Append(ac, s, ac.Int(1))
-	if cap(s) != 32 || *s[0] != 1 {
-		t.Fail()
+	free = ac.CurrentChunkFree()
+	obj, release := NewScoped[PbItem](ac)
+	obj.Id = new(int)
+	release()
+	release()
+	if ac.CurrentChunkFree() != free {
+		t.Errorf("not reclaimed")
 	}
 
-	intSlice := []int{}
-	intSlice = Append(ac, intSlice, 11)
-	if len(intSlice) != 1 || intSlice[0] != 11 {
-		t.Fail()
+	if obj, release := NewScoped[PbItem](nil); obj == nil {
+		t.Errorf("heap")
+	} else {
+		release()
 	}
+}
 
-	byteSlice := []byte{}
-	byteSlice = Append(ac, byteSlice, byte(11))
-	if len(byteSlice) != 1 || byteSlice[0] != 11 {
-		t.Fail()
+func Test_OversizedAlignment(t *testing.T) {
+	p := NewAllocatorPool("oversized", nil, 1, 1024, 0, 0)
+	ac := p.Get()
+	defer ac.Release()
+
+	type Big struct {
+		b   byte
+		arr [300]uint64
+		c   [3]byte
+	}
+	if unsafe.Sizeof(Big{}) <= 1024 {
+		t.Fatalf("should be larger than chunk size")
 	}
 
-	type Data struct {
-		d [2]uint64
+	for i := 0; i < 3; i++ {
+		ac.Bool(true)
+		b := New[Big](ac)
+		if uintptr(unsafe.Pointer(b))%unsafe.Alignof(*b) != 0 || uintptr(unsafe.Pointer(&b.arr))%unsafe.Alignof(b.arr) != 0 {
+			t.Errorf("not aligned: %p", b)
+		}
+		if ac.CurrentChunkFree() < 0 {
+			t.Errorf("chunk overflowed")
+		}
+		b.arr[299] = 1
 	}
-	structSlice := []Data{}
-	d1 := uint64(0xcdcdefefcdcdefdc)
-	d2 := uint64(0xcfcdefefcdcfffde)
-	structSlice = Append(ac, structSlice, Data{d: [2]uint64{d1, d2}})
-	if len(structSlice) != 1 || structSlice[0].d[0] != d1 || structSlice[0].d[1] != d2 {
-		t.Fail()
+}
+
+func Test_LargeChunkPool(t *testing.T) {
+	p := NewAllocatorPool("large", nil, 2, 1024, 0, 0)
+	p.EnableLargeChunkPool([]int{16 * 1024, 4 * 1024}, 2)
+
+	ac := p.Get()
+	b := NewSlice[byte](ac, 3000, 3000)
+	huge := NewSlice[byte](ac, 20000, 20000)
+	if cap(b) != 3000 || cap(huge) != 20000 {
+		t.Fatalf("cap")
 	}
+	ac.Release()
 
-	f := func() []int {
-		var r []int = NewSlice[int](ac, 0, 1)
-		r = Append(ac, r, 1)
-		return r
+	// reused by another allocator.
+	ac = p.Get()
+	defer ac.Release()
+	b2 := NewSlice[byte](ac, 4000, 4000)
+	if &b[0] != &b2[0] {
+		t.Errorf("large chunk not reused")
 	}
-	r := f()
-	if len(r) != 1 {
-		t.Errorf("return slice")
+	NewSlice[byte](ac, 10000, 10000)
+
+	if !strings.Contains(p.DumpStats(false), "reused:1, created:2, pooled:0") {
+		t.Errorf("stats: %v", p.DumpStats(false))
 	}
+}
 
-	{
-		var s []*PbItem
-		s = Append(ac, s, nil)
-		if len(s) != 1 || s[0] != nil {
-			t.Errorf("nil")
-		}
+func Test_PoolHooks(t *testing.T) {
+	p := NewAllocatorPool("hooks", nil, 1, 1024, 1, 0)
+	var sizes []int
+	misses := 0
+	p.OnChunkCreate = func(size int) { sizes = append(sizes, size) }
+	p.OnPoolMiss = func() { misses++ }
+
+	ac := p.Get()
+	defer ac.Release()
+	NewSlice[byte](ac, 1000, 1000) // reserved chunk
+	NewSlice[byte](ac, 1000, 1000)
+	NewSlice[byte](ac, 2000, 2000)
+
+	if misses != 1 || len(sizes) != 2 || sizes[0] != 1024 || sizes[1] != 2000 {
+		t.Errorf("misses: %v, sizes: %v", misses, sizes)
 	}
 }
 
-func Test_NewFromRaw(b *testing.T) {
-	var ac *Allocator
+func Test_ByteBudget(t *testing.T) {
+	p := NewAllocatorPool("budget", nil, 2, 1024, 0, 0)
+	p.SetByteBudget(2048)
+	var over []int64
+	p.OnOverBudget = func(n int64) { over = append(over, n) }
+
+	ac := p.Get()
+	NewSlice[byte](ac, 1000, 1000)
+	ac2 := p.Get()
+	NewSlice[byte](ac2, 1000, 1000)
+	if p.IsOverBudget() || len(over) != 0 || p.Stats.OutstandingBytes.Load() != 2048 {
+		t.Errorf("should be in budget: %v", p.Stats.OutstandingBytes.Load())
+	}
+	NewSlice[byte](ac2, 1000, 1000)
+	if !p.IsOverBudget() || len(over) != 1 || over[0] != 3072 || p.Stats.OverBudget.Load() != 1 {
+		t.Errorf("should be over budget: %v", over)
+	}
+	if !strings.Contains(p.DumpStats(false), "[budget]bytes:2048, outstanding:3072") {
+		t.Errorf("stats: %v", p.DumpStats(false))
+	}
 
-	for i := 0; i < 3; i++ {
-		d := NewFrom(ac, &PbItem{
-			Id:    ac.Int(1 + i),
-			Class: ac.Int(2 + i),
-			Price: ac.Int(3 + i),
-			Name:  ac.String("test"),
-		})
+	ac2.Release()
+	if p.IsOverBudget() || p.Stats.OutstandingBytes.Load() != 1024 {
+		t.Errorf("outstanding: %v", p.Stats.OutstandingBytes.Load())
+	}
+	ac.Release()
+	if p.Stats.OutstandingBytes.Load() != 0 {
+		t.Errorf("outstanding: %v", p.Stats.OutstandingBytes.Load())
+	}
+}
 
-		if *d.Id != 1+i {
-			b.Fail()
+func Test_SliceOverBytes(t *testing.T) {
+	ac := acPool.Get()
+	defer ac.Release()
+
+	b := NewSlice[byte](ac, 16, 20)
+	u := SliceOverBytes[uint32](b)
+	if len(u) != 4 || cap(u) != 5 {
+		t.Errorf("len: %v, cap: %v", len(u), cap(u))
+	}
+	u[1] = 0x01020304
+	if b[4] != 4 && b[4] != 1 {
+		t.Errorf("not aliased")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("should panic")
 		}
-		if *d.Class != 2+i {
-			b.Fail()
+	}()
+	SliceOverBytes[uint64](b[:12])
+}
+
+func Test_SliceFromScratch(t *testing.T) {
+	var buf [64]byte
+	for i := range buf {
+		buf[i] = 0xff
+	}
+
+	b, rest := SliceFromScratch[byte](buf[1:], 3)
+	u, rest := SliceFromScratch[uint64](rest, 4)
+	if len(b) != 3 || len(u) != 4 || cap(u) != 4 {
+		t.Fatalf("len: %v, %v", len(b), len(u))
+	}
+	if uintptr(unsafe.Pointer(&u[0]))%unsafe.Alignof(u[0]) != 0 {
+		t.Errorf("not aligned")
+	}
+	for _, v := range u {
+		if v != 0 {
+			t.Errorf("not zeroed")
 		}
-		if *d.Price != 3+i {
-			b.Fail()
+	}
+	u[3] = 1
+	if uintptr(unsafe.Pointer(&rest[0])) != uintptr(unsafe.Pointer(&u[3]))+8 {
+		t.Errorf("rest")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("should panic")
 		}
-		if *d.Name != "test" {
-			b.Fail()
+	}()
+	SliceFromScratch[uint64](rest, len(rest))
+}
+
+func Test_HeapFallback(t *testing.T) {
+	p := NewAllocatorPool("fallback", nil, 1, 1024, 0, 0)
+	p.HeapFallbackAbove = 4096
+
+	ac := p.Get()
+	defer ac.Release()
+
+	small := NewSlice[byte](ac, 4096, 4096)
+	big := NewSliceFilled[int64](ac, 1000, 1)
+	if p.Stats.HeapFallbacks.Load() != 1 {
+		t.Errorf("fallbacks: %v", p.Stats.HeapFallbacks.Load())
+	}
+	if ac.checkPointerType(uintptr(unsafe.Pointer(&small[0]))) != pointerTypeLacInternal {
+		t.Errorf("small should be in chunks")
+	}
+	runtime.GC()
+	for _, v := range big {
+		if v != 1 {
+			t.Fatalf("corrupted")
 		}
 	}
+	if !strings.Contains(p.DumpStats(false), "heap_fallbacks:1") {
+		t.Errorf("stats: %v", p.DumpStats(false))
+	}
 }
 
-func Test_NewFrom(b *testing.T) {
+func Test_HeapFallbackReset(t *testing.T) {
+	p := NewAllocatorPool("fallbackReset", nil, 1, 1024, 0, 0)
+	p.HeapFallbackAbove = 4096
+	p.ZeroOnReset = true
+
+	ac := p.Get()
+	big := NewSliceFilled[int64](ac, 1000, 1)
+	if n := p.Stats.OutstandingBytes.Load(); n != 8000 {
+		t.Errorf("outstanding: %v", n)
+	}
+	ac.Release()
+	if n := p.Stats.OutstandingBytes.Load(); n != 0 {
+		t.Errorf("outstanding after reset: %v", n)
+	}
+	for _, v := range big {
+		if v != 0 {
+			t.Fatalf("not wiped")
+		}
+	}
+}
+
+func Test_Reusable(t *testing.T) {
+	acPool.EnableDebugMode(true)
+	defer acPool.EnableDebugMode(false)
+	ac := acPool.Get()
+
+	type D struct {
+		item *PbItem
+	}
+	d := New[D](ac)
+	r := Reusable[PbItem](ac, "item")
+	r.Id = ac.Int(1)
+	d.item = r
+	if Reusable[PbItem](ac, "item") != r {
+		t.Errorf("not cached")
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("should panic on type mismatch")
+			}
+		}()
+		Reusable[PbData](ac, "item")
+	}()
+	ac.Release()
+
+	if r.Id != nil {
+		t.Errorf("not zeroed on reset")
+	}
+}
+
+func Test_ZeroOnReset(t *testing.T) {
+	p := NewAllocatorPool("zero", nil, 1, 1024, 0, 0)
+	p.ZeroOnReset = true
+
+	ac := p.Get()
+	secret := ac.AppendString(nil, "secret")
+	big := NewSliceFilled[byte](ac, 2000, 1)
+	ac.Release()
+
+	for _, b := range [][]byte{secret, big} {
+		for _, c := range b {
+			if c != 0 {
+				t.Fatalf("not wiped: %v", b)
+			}
+		}
+	}
+}
+
+func Test_CMem(t *testing.T) {
 	ac := acPool.Get()
 	defer ac.Release()
 
-	for i := 0; i < 3; i++ {
-		d := NewFrom(ac, &PbItem{
-			Id:    ac.Int(1 + i),
-			Class: ac.Int(2 + i),
-			Price: ac.Int(3 + i),
-			Name:  ac.String("test"),
-		})
+	p := ac.CMem(100)
+	b := unsafe.Slice((*byte)(p), 100)
+	for _, v := range b {
+		if v != 0 {
+			t.Fatalf("not zeroed")
+		}
+	}
+	if uintptr(p)%uintptr(ptrSize) != 0 || ac.checkPointerType(uintptr(p)) != pointerTypeLacInternal {
+		t.Errorf("should be aligned and allocated from lac")
+	}
+	runtime.GC()
+	if ac.CMem(1) == p {
+		t.Errorf("overlapped")
+	}
+	if (*Allocator)(nil).CMem(1) == nil {
+		t.Errorf("heap")
+	}
+	if (*Allocator)(nil).CMem(0) != nil || ac.CMem(0) != nil {
+		t.Errorf("empty")
+	}
+}
 
-		if *d.Id != 1+i {
-			b.Fail()
+func Test_AlignTo(t *testing.T) {
+	p := NewAllocatorPool("align", nil, 1, 1024, 0, 0)
+	ac := p.Get()
+	defer ac.Release()
+
+	for _, align := range []int{1, 8, 64, 256, 512} {
+		for i := 0; i < 20; i++ {
+			ac.Bool(true)
+			ac.AlignTo(align)
+			b := NewSlice[byte](ac, 24, 24)
+			if uintptr(unsafe.Pointer(&b[0]))%uintptr(align) != 0 {
+				t.Fatalf("not aligned to %v: %p", align, &b[0])
+			}
 		}
-		if *d.Class != 2+i {
-			b.Fail()
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("should panic")
 		}
-		if *d.Price != 3+i {
-			b.Fail()
+	}()
+	ac.AlignTo(24)
+}
+
+func Test_NewPageAlignedBytes(t *testing.T) {
+	ac := acPool.Get()
+	defer ac.Release()
+
+	for _, n := range []int{0, 1, 100, pageSize, 3 * acPool.ChunkSize()} {
+		ac.Bool(true)
+		b := ac.NewPageAlignedBytes(n)
+		if len(b) != n || cap(b) != n {
+			t.Fatalf("len: %v, cap: %v", len(b), cap(b))
 		}
-		if *d.Name != "test" {
-			b.Fail()
+		if n == 0 {
+			continue
 		}
+		if uintptr(unsafe.Pointer(&b[0]))%uintptr(pageSize) != 0 || ac.checkPointerType(uintptr(unsafe.Pointer(&b[0]))) != pointerTypeLacInternal {
+			t.Errorf("should be page aligned and allocated from lac: %p", &b[0])
+		}
+		b[n-1] = 1
+	}
+	runtime.GC()
+
+	b := (*Allocator)(nil).NewPageAlignedBytes(10)
+	if len(b) != 10 || uintptr(unsafe.Pointer(&b[0]))%uintptr(pageSize) != 0 {
+		t.Errorf("heap: %p", &b[0])
 	}
 }
 
-func Test_BuildInAllocator(t *testing.T) {
-	var ac *Allocator
+func Test_Chunks(t *testing.T) {
+	p := NewAllocatorPool("chunks", nil, 1, 64, 0, 0)
+	ac := p.Get()
 	defer ac.Release()
 
-	item := New[PbItem](ac)
-	item.Id = ac.Int(11)
-	if *item.Id != 11 {
-		t.Fail()
+	// structure of arrays with offsets only.
+	ids := NewSlice[int32](ac, 8, 8)
+	for i := range ids {
+		ids[i] = int32(i)
 	}
-	id2 := 22
-	item = NewFrom(ac, &PbItem{Id: &id2})
-	if *item.Id != 22 {
-		t.Fail()
+	names := NewSlice[byte](ac, 40, 40)
+	copy(names, "a long name in the second chunk.........")
+
+	var blob []byte
+	n := 0
+	ac.Chunks()(func(b []byte) bool {
+		blob = append(blob, b...)
+		n++
+		return true
+	})
+	if n != 2 || len(blob) != 32+40 {
+		t.Fatalf("chunks: %v, bytes: %v", n, len(blob))
 	}
-	s := NewSlice[*PbItem](ac, 0, 3)
-	if cap(s) != 3 || len(s) != 0 {
-		t.Fail()
+
+	// restore from the snapshot.
+	restored := NewSlice[byte](ac, len(blob), len(blob))
+	copy(restored, blob)
+	rids := unsafe.Slice((*int32)(unsafe.Pointer(&restored[0])), 8)
+	if rids[7] != 7 || string(restored[32:]) != string(names) {
+		t.Errorf("restored: %v, %q", rids, restored[32:])
 	}
-	s = Append(ac, s, item)
-	if len(s) != 1 || *s[0].Id != 22 {
-		t.Fail()
+
+	n = 0
+	ac.Chunks()(func(b []byte) bool {
+		n++
+		return false
+	})
+	if n != 1 {
+		t.Errorf("should stop: %v", n)
 	}
-	m := NewMap[int, string](ac, 0)
-	m[1] = "test"
-	if m[1] != "test" {
-		t.Fail()
+	(*Allocator)(nil).Chunks()(func(b []byte) bool {
+		t.Errorf("nil allocator")
+		return true
+	})
+}
+
+func Test_LastCycleStats(t *testing.T) {
+	p := NewAllocatorPool("cycleStats", nil, 1, 1024, 0, 0)
+	p.CountObjects = true
+
+	ac := p.Get()
+	ac.Int(1)
+	ac.Bool(true)
+	NewSlice[byte](ac, 10, 10)
+	if o, b := ac.CycleStats(); o != 3 || b != int64(ptrSize)+1+10 {
+		t.Errorf("current, objects: %v, bytes: %v", o, b)
 	}
-	e := EnumVal1
-	v := NewEnum(ac, e)
-	if *v != e {
-		t.Fail()
+	ac.Release()
+
+	ac = p.Get()
+	if o, b := ac.LastCycleStats(); o != 3 || b != int64(ptrSize)+1+10 {
+		t.Errorf("objects: %v, bytes: %v", o, b)
 	}
-}
+	ac.IncRef()
+	ac.Int(2)
+	ac.DecRef()
+	ac.DecRef()
 
-func Test_Enum(t *testing.T) {
-	ac := acPool.Get()
+	ac = p.Get()
 	defer ac.Release()
+	if o, b := ac.LastCycleStats(); o != 1 || b != int64(ptrSize) {
+		t.Errorf("multi-threaded, objects: %v, bytes: %v", o, b)
+	}
+
+	p.CountObjects = false
+	ac.Int(3)
+	ac.reset()
+	if o, b := ac.LastCycleStats(); o != 0 || b != int64(ptrSize) {
+		t.Errorf("not counted, objects: %v, bytes: %v", o, b)
+	}
+}
+
+func Test_AllocatorPool(t *testing.T) {
+	ac := acPool.Get()
+	defer ac.Release()
+
+	if ac.Pool() != acPool || ac.Pool().ChunkSize() != 64*1024 {
+		t.Fail()
+	}
+	var nilAc *Allocator
+	if nilAc.Pool() != nil || nilAc.Pool().ChunkSize() != 0 {
+		t.Fail()
+	}
+}
+
+func Test_String(t *testing.T) {
+	ac := acPool.Get()
+	defer ac.Release()
+
+	type D struct {
+		s [5]*string
+	}
+	d := New[D](ac)
+	for i := range d.s {
+		d.s[i] = ac.String(fmt.Sprintf("str%v", i))
+		runtime.GC()
+	}
+	for i, p := range d.s {
+		if *p != fmt.Sprintf("str%v", i) {
+			t.Errorf("elem %v is gced", i)
+		}
+	}
+}
+
+func Test_NewPtrSliceInit(t *testing.T) {
+	acPool.EnableDebugMode(true)
+	defer acPool.EnableDebugMode(false)
+	ac := acPool.Get()
+	defer ac.Release()
+
+	d := New[PbData](ac)
+	d.Items = NewPtrSliceInit(ac, 10, func(i int, p *PbItem) {
+		p.Id = ac.Int(i)
+	})
+	runtime.GC()
+
+	for i, item := range d.Items {
+		if *item.Id != i || item.Name != nil {
+			t.Errorf("item %v: %+v", i, item)
+		}
+		if i > 0 && uintptr(unsafe.Pointer(item))-uintptr(unsafe.Pointer(d.Items[i-1])) != unsafe.Sizeof(PbItem{}) {
+			t.Errorf("not contiguous")
+		}
+	}
+	if err := ac.CheckExternalPointersOf(d); err != nil {
+		t.Errorf("unexpected: %v", err)
+	}
+	if len(NewPtrSliceInit[PbItem](ac, 3, nil)) != 3 || NewPtrSliceInit[PbItem](ac, 0, nil) != nil {
+		t.Errorf("len")
+	}
+	if s := NewPtrSliceInit[PbItem](nil, 2, nil); len(s) != 2 || s[1] == nil {
+		t.Errorf("heap")
+	}
+}
+
+func Test_FillPtrs(t *testing.T) {
+	acPool.EnableDebugMode(true)
+	defer acPool.EnableDebugMode(false)
+	ac := acPool.Get()
+	defer ac.Release()
+
+	type D struct {
+		v [4]*PbItem
+	}
+	d := New[D](ac)
+	FillPtrs(ac, d.v[:])
+	for i, item := range d.v {
+		item.Id = ac.Int(i)
+	}
+	runtime.GC()
+
+	for i, item := range d.v {
+		if *item.Id != i || (i > 0 && uintptr(unsafe.Pointer(item))-uintptr(unsafe.Pointer(d.v[i-1])) != unsafe.Sizeof(PbItem{})) {
+			t.Errorf("item %v: %+v", i, item)
+		}
+	}
+	if err := ac.CheckExternalPointersOf(d); err != nil {
+		t.Errorf("unexpected: %v", err)
+	}
+
+	d.v[2].Class = new(int)
+	if err := ac.CheckExternalPointersOf(d); err == nil || !strings.Contains(err.Error(), "D.v[2]: PbItem.Class: unexpected external pointer") {
+		t.Errorf("failed to check: %v", err)
+	}
+	d.v[2].Class = nil
+}
+
+func Test_Ints(t *testing.T) {
+	ac := acPool.Get()
+	defer ac.Release()
+
+	item := New[PbItemEx](ac)
+	p := ac.Ints(1, 2, 3)
+	item.Id1, item.Id2, item.Id3 = p[0], p[1], p[2]
+	runtime.GC()
+
+	if *item.Id1 != 1 || *item.Id2 != 2 || *item.Id3 != 3 {
+		t.Errorf("values: %v, %v, %v", *item.Id1, *item.Id2, *item.Id3)
+	}
+	if uintptr(unsafe.Pointer(item.Id3))-uintptr(unsafe.Pointer(item.Id1)) != 2*unsafe.Sizeof(0) {
+		t.Errorf("not contiguous")
+	}
+	if err := ac.CheckExternalPointersOf(item); err != nil {
+		t.Errorf("unexpected: %v", err)
+	}
+	noMalloc(func() {
+		ac.Ints(4, 5, 6, 7)
+	})
+	if ac.Ints() != nil {
+		t.Errorf("should be nil")
+	}
+
+	p = (*Allocator)(nil).Ints(8, 9)
+	if len(p) != 2 || *p[0] != 8 || *p[1] != 9 {
+		t.Errorf("heap: %v", p)
+	}
+}
+
+func Test_StringPtrFrom(t *testing.T) {
+	ac := acPool.Get()
+	defer ac.Release()
+
+	type D struct {
+		s [5]*string
+	}
+	d := New[D](ac)
+	for i := range d.s {
+		src := new(string)
+		*src = fmt.Sprintf("str%v", i)
+		d.s[i] = ac.StringPtrFrom(src)
+		*src = ""
+		runtime.GC()
+	}
+	for i, p := range d.s {
+		if *p != fmt.Sprintf("str%v", i) {
+			t.Errorf("elem %v is gced", i)
+		}
+		if ac.checkPointerType(uintptr(unsafe.Pointer(p))) != pointerTypeLacInternal ||
+			ac.checkPointerType(uintptr((*stringHeader)(unsafe.Pointer(p)).Data)) != pointerTypeLacInternal {
+			t.Errorf("elem %v not copied", i)
+		}
+	}
+	if err := ac.CheckExternalPointersOf(d); err != nil {
+		t.Errorf("unexpected: %v", err)
+	}
+	if ac.StringPtrFrom(nil) != nil {
+		t.Errorf("should be nil")
+	}
+}
+
+func Test_NewMap(t *testing.T) {
+	ac := acPool.Get()
+	defer ac.Release()
+
+	type D struct {
+		m map[int]*int
+	}
+	data := [10]*D{}
+	for i := 0; i < len(data); i++ {
+		d := New[D](ac)
+		d.m = NewMap[int, *int](ac, 0)
+		d.m[1] = ac.Int(i)
+		data[i] = d
+		runtime.GC()
+	}
+	for i, d := range data {
+		if *d.m[1] != i {
+			t.Fail()
+		}
+	}
+}
+
+func Test_NestedMap(t *testing.T) {
+	ac := acPool.Get()
+	defer ac.Release()
+
+	type D struct {
+		m map[int]map[int]*int
+	}
+	d := New[D](ac)
+	d.m = NewMap[int, map[int]*int](ac, 0)
+	for i := 0; i < 100; i++ {
+		// inner maps are referenced by the outer map only.
+		inner := make(map[int]*int)
+		inner[i] = ac.Int(i)
+		d.m[i] = inner
+		if i%10 == 0 {
+			runtime.GC()
+		}
+	}
+	runtime.GC()
+	for i := 0; i < 100; i++ {
+		if *d.m[i][i] != i {
+			t.Fatalf("corrupted: %v", i)
+		}
+	}
+}
+
+func Test_NewSlice(t *testing.T) {
+	acPool.EnableDebugMode(true)
+	ac := acPool.Get()
+	defer ac.Release()
+
+	s := make([]*int, 0)
+	s = Append(ac, s, ac.Int(2))
+	if len(s) != 1 && *s[0] != 2 {
+		t.Fail()
+	}
+
+	s = NewSlice[*int](ac, 0, 32)
+	s = Append(ac, s, ac.Int(1))
+	if cap(s) != 32 || *s[0] != 1 {
+		t.Fail()
+	}
+
+	intSlice := []int{}
+	intSlice = Append(ac, intSlice, 11)
+	if len(intSlice) != 1 || intSlice[0] != 11 {
+		t.Fail()
+	}
+
+	byteSlice := []byte{}
+	byteSlice = Append(ac, byteSlice, byte(11))
+	if len(byteSlice) != 1 || byteSlice[0] != 11 {
+		t.Fail()
+	}
+
+	type Data struct {
+		d [2]uint64
+	}
+	structSlice := []Data{}
+	d1 := uint64(0xcdcdefefcdcdefdc)
+	d2 := uint64(0xcfcdefefcdcfffde)
+	structSlice = Append(ac, structSlice, Data{d: [2]uint64{d1, d2}})
+	if len(structSlice) != 1 || structSlice[0].d[0] != d1 || structSlice[0].d[1] != d2 {
+		t.Fail()
+	}
+
+	f := func() []int {
+		var r []int = NewSlice[int](ac, 0, 1)
+		r = Append(ac, r, 1)
+		return r
+	}
+	r := f()
+	if len(r) != 1 {
+		t.Errorf("return slice")
+	}
+
+	{
+		var s []*PbItem
+		s = Append(ac, s, nil)
+		if len(s) != 1 || s[0] != nil {
+			t.Errorf("nil")
+		}
+	}
+}
+
+func Test_NewFromRaw(b *testing.T) {
+	var ac *Allocator
+
+	for i := 0; i < 3; i++ {
+		d := NewFrom(ac, &PbItem{
+			Id:    ac.Int(1 + i),
+			Class: ac.Int(2 + i),
+			Price: ac.Int(3 + i),
+			Name:  ac.String("test"),
+		})
+
+		if *d.Id != 1+i {
+			b.Fail()
+		}
+		if *d.Class != 2+i {
+			b.Fail()
+		}
+		if *d.Price != 3+i {
+			b.Fail()
+		}
+		if *d.Name != "test" {
+			b.Fail()
+		}
+	}
+}
+
+func Test_NewFrom(b *testing.T) {
+	ac := acPool.Get()
+	defer ac.Release()
+
+	for i := 0; i < 3; i++ {
+		d := NewFrom(ac, &PbItem{
+			Id:    ac.Int(1 + i),
+			Class: ac.Int(2 + i),
+			Price: ac.Int(3 + i),
+			Name:  ac.String("test"),
+		})
+
+		if *d.Id != 1+i {
+			b.Fail()
+		}
+		if *d.Class != 2+i {
+			b.Fail()
+		}
+		if *d.Price != 3+i {
+			b.Fail()
+		}
+		if *d.Name != "test" {
+			b.Fail()
+		}
+	}
+}
+
+func Test_BuildInAllocator(t *testing.T) {
+	var ac *Allocator
+	defer ac.Release()
+
+	item := New[PbItem](ac)
+	item.Id = ac.Int(11)
+	if *item.Id != 11 {
+		t.Fail()
+	}
+	id2 := 22
+	item = NewFrom(ac, &PbItem{Id: &id2})
+	if *item.Id != 22 {
+		t.Fail()
+	}
+	s := NewSlice[*PbItem](ac, 0, 3)
+	if cap(s) != 3 || len(s) != 0 {
+		t.Fail()
+	}
+	s = Append(ac, s, item)
+	if len(s) != 1 || *s[0].Id != 22 {
+		t.Fail()
+	}
+	m := NewMap[int, string](ac, 0)
+	m[1] = "test"
+	if m[1] != "test" {
+		t.Fail()
+	}
+	e := EnumVal1
+	v := NewEnum(ac, e)
+	if *v != e {
+		t.Fail()
+	}
+}
+
+func Test_Enum(t *testing.T) {
+	ac := acPool.Get()
+	defer ac.Release()
+
+	e := EnumVal2
+	v := NewEnum(ac, e)
+	if *v != e {
+		t.Fail()
+	}
+}
+
+func Test_Complex(t *testing.T) {
+	acPool.EnableDebugMode(true)
+	ac := acPool.Get()
+	defer ac.Release()
+
+	type D struct {
+		c64  *complex64
+		c128 *complex128
+		v    complex128
+	}
+	d := New[D](ac)
+	d.c64 = ac.Complex64(complex(1, 2))
+	d.c128 = ac.Complex128(complex(3, 4))
+	d.v = complex(5, 6)
+	runtime.GC()
+
+	if *d.c64 != complex(1, 2) || *d.c128 != complex(3, 4) {
+		t.Fail()
+	}
+}
+
+func Test_ScalarSlice(t *testing.T) {
+	ac := acPool.Get()
+	defer ac.Release()
+
+	for _, ac := range []*Allocator{ac, nil} {
+		i32 := ac.Int32Slice(1, 2, 3)
+		if len(i32) != 3 || cap(i32) != 3 || i32[2] != 3 {
+			t.Errorf("int32: %v", i32)
+		}
+		src := []float64{1.5, 2.5}
+		f64 := ac.Float64Slice(src...)
+		src[0] = 0
+		if f64[0] != 1.5 || f64[1] != 2.5 {
+			t.Errorf("float64 should be copied: %v", f64)
+		}
+		if len(ac.BoolSlice()) != 0 {
+			t.Errorf("empty")
+		}
+	}
+}
+
+func Test_NewStringReuseInternal(t *testing.T) {
+	NewStringReuseInternal = true
+	defer func() { NewStringReuseInternal = false }()
+
+	ac := acPool.Get()
+	defer ac.Release()
+
+	s := ac.NewString(strings.Repeat("a", 10) + "hello")
+	sub := s[10:]
+	data := func(s string) unsafe.Pointer { return (*stringHeader)(unsafe.Pointer(&s)).Data }
+	if r := ac.NewString(sub); data(r) != data(sub) {
+		t.Errorf("internal string copied")
+	}
+	heap := strings.Repeat("b", 10)
+	if r := ac.NewString(heap); data(r) == data(heap) || r != heap {
+		t.Errorf("external string not copied")
+	}
+}
+
+func Test_TimeSlice(t *testing.T) {
+	acPool.WithDebug(func() {
+		ac := acPool.Get()
+		defer ac.Release()
+
+		type D struct {
+			times []time.Time
+		}
+		d := New[D](ac)
+		func() {
+			var ts []time.Time
+			for i := 0; i < 10; i++ {
+				// heap allocated locations only referenced by the copies.
+				loc := time.FixedZone(fmt.Sprintf("zone%d", i%3), i%3*3600)
+				ts = append(ts, time.Date(2020, 1, i+1, 0, 0, 0, 0, loc))
+			}
+			ts = append(ts, time.Unix(0, 0).UTC())
+			d.times = ac.TimeSlice(ts)
+		}()
+
+		for i := 0; i < 3; i++ {
+			runtime.GC()
+		}
+		for i := 0; i < 10; i++ {
+			_, off := d.times[i].Zone()
+			if d.times[i].Day() != i+1 || off != i%3*3600 || d.times[i].Location().String() != fmt.Sprintf("zone%d", i%3) {
+				t.Errorf("corrupted: %v", d.times[i])
+			}
+		}
+		if d.times[10].Location() != time.UTC {
+			t.Errorf("utc")
+		}
+	})
+}
+
+func Test_AttachExternal(b *testing.T) {
+	ac := acPool.Get()
+	defer ac.Release()
+
+	const sz = 100
+
+	type D struct {
+		d  [sz]*int
+		s  [sz]string
+		ar [sz][]int
+	}
+
+	fail := false
+
+	d := New[D](ac)
+	for i := 0; i < len(d.d); i++ {
+		// pointer
+		if fail {
+			d.d[i] = new(int)
+		} else {
+			d.d[i] = Attach(ac, new(int))
+		}
+		*d.d[i] = i
+
+		// string
+		if fail {
+			d.s[i] = fmt.Sprintf("%d", i)
+		} else {
+			d.s[i] = Attach(ac, fmt.Sprintf("%d", i))
+		}
+
+		// slice
+		if fail {
+			d.ar[i] = []int{0, 1, 2, 3}
+		} else {
+			d.ar[i] = Attach(ac, []int{0, 1, 2, 3})
+		}
+
+		runtime.GC()
+	}
+
+	for i := 0; i < len(d.d); i++ {
+		if *d.d[i] != i {
+			b.Errorf("int should not be gced.")
+		}
+		if d.s[i] != fmt.Sprintf("%d", i) {
+			b.Errorf("string should not be gced.")
+		}
+		if len(d.ar[i]) != 4 {
+			b.Errorf("slice should not be gced.")
+		}
+		for idx, v := range d.ar[i] {
+			if v != idx {
+				b.Errorf("slice gced")
+			}
+		}
+	}
+}
+
+func Test_Append(t *testing.T) {
+	ac := acPool.Get()
+	defer ac.Release()
+
+	m := map[int][]int{}
+
+	for i := 0; i < 10; i++ {
+		for j := 0; j < 10; j++ {
+			m[i] = Append(ac, m[i], j)
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		for j := 0; j < 10; j++ {
+			if m[i][j] != j {
+				t.Fail()
+			}
+		}
+	}
+}
+
+func Test_NewSliceElemSize(t *testing.T) {
+	ac := acPool.Get()
+	defer ac.Release()
+
+	s := NewSlice[[4]int](ac, 2, 2)
+	i := ac.Int(7)
+	s[1] = [4]int{1, 2, 3, 4}
+	if *i != 7 {
+		t.Errorf("overlapped memory")
+	}
+}
+
+func Test_AllocObjects(t *testing.T) {
+	acPool.EnableDebugMode(true)
+	defer acPool.EnableDebugMode(false)
+	ac := acPool.Get()
+	defer ac.Release()
+
+	// dirty the memory to be reused.
+	ac2 := acPool.Get()
+	NewSliceFilled[int64](ac2, 100, -1)
+	ac2.Release()
+
+	type D struct {
+		items []*PbItem
+	}
+	d := New[D](ac)
+	objs := AllocObjects[PbItem](ac, 10)
+	for i := range objs {
+		if objs[i].Id != nil || objs[i].Price != nil {
+			t.Errorf("not zeroed")
+		}
+		objs[i].Id = ac.Int(i)
+		d.items = Append(ac, d.items, &objs[i])
+	}
+	runtime.GC()
+	if *d.items[9].Id != 9 || uintptr(unsafe.Pointer(&objs[1]))-uintptr(unsafe.Pointer(&objs[0])) != unsafe.Sizeof(objs[0]) {
+		t.Errorf("not contiguous")
+	}
+}
+
+func Test_Scoped(t *testing.T) {
+	ac := acPool.Get()
+	defer ac.Release()
+
+	ac.Int(1)
+	free := ac.CurrentChunkFree()
+	sum := 0
+	Scoped(ac, 100, func(s []int) {
+		for i := range s {
+			s[i] = i
+		}
+		for _, v := range s {
+			sum += v
+		}
+		if ac.CurrentChunkFree() >= free {
+			t.Errorf("not allocated from chunk")
+		}
+	})
+	if sum != 4950 || ac.CurrentChunkFree() != free {
+		t.Errorf("sum: %v, free: %v, expected: %v", sum, ac.CurrentChunkFree(), free)
+	}
+}
+
+func Test_NewSliceFilled(t *testing.T) {
+	ac := acPool.Get()
+	defer ac.Release()
+
+	for _, a := range []*Allocator{ac, nil} {
+		for _, n := range []int{0, 1, 7, 100} {
+			s := NewSliceFilled(a, n, int16(-1))
+			if len(s) != n {
+				t.Errorf("len: %v", len(s))
+			}
+			for _, v := range s {
+				if v != -1 {
+					t.Fatalf("not filled")
+				}
+			}
+		}
+		p := ac.Int(1)
+		for _, v := range NewSliceFilled(a, 33, p) {
+			if v != p {
+				t.Fatalf("not filled")
+			}
+		}
+	}
+}
+
+func Test_NewSliceUninit(t *testing.T) {
+	p := NewAllocatorPool("uninit", nil, 1, 1024, 0, 0)
+	ac := p.Get()
+	NewSliceFilled[byte](ac, 1000, 0xff)
+	ac.Release()
+
+	ac = p.Get()
+	defer ac.Release()
+	type D struct {
+		v int
+	}
+	ptrs := NewSlice[*int](ac, 4, 4)
+	structs := NewSlice[D](ac, 4, 4)
+	for i := range ptrs {
+		if ptrs[i] != nil || structs[i].v != 0 {
+			t.Errorf("should be zeroed")
+		}
+	}
+	// scalars are left uninitialized.
+	if ints := NewSliceUninit[int](ac, 4, 4); ints[0] != -1 {
+		t.Errorf("unexpected zeroing: %v", ints)
+	}
+}
+
+func Test_EmptyNoAlloc(t *testing.T) {
+	ac := acPool.Get()
+	defer ac.Release()
+
+	ac.Int(0)
+	free := ac.CurrentChunkFree()
+	if ac.NewString("") != "" || NewSlice[int](ac, 0, 0) != nil || ac.CurrentChunkFree() != free {
+		t.Errorf("should not allocate")
+	}
+	if s := ac.String(""); *s != "" || ac.CurrentChunkFree() != free-ptrSize*2 {
+		t.Errorf("should only allocate the header")
+	}
+}
+
+func Test_AppendLargeContiguous(t *testing.T) {
+	p := NewAllocatorPool("contiguous", nil, 1, 64*1024, 0, 0)
+	ac := p.Get()
+	defer ac.Release()
+
+	const n = 512 * 1024 // 4MB
+	var s []int
+	for i := 0; i < n; i++ {
+		s = Append(ac, s, i)
+	}
+	for i, v := range s {
+		if v != i {
+			t.Fatalf("s[%v]: %v", i, v)
+		}
+	}
+
+	begin := uintptr(unsafe.Pointer(&s[0]))
+	end := uintptr(unsafe.Pointer(&s[len(s)-1])) + unsafe.Sizeof(s[0])
+	found := false
+	for _, c := range ac.chunks {
+		if begin >= uintptr(c.Data) && end <= uintptr(c.Data)+uintptr(c.Cap) {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("backing array is not in a single chunk")
+	}
+}
+
+func Test_NewSlicePtr(t *testing.T) {
+	ac := acPool.Get()
+	defer ac.Release()
+
+	p := NewSlicePtr[*int](ac, 1, 2)
+	(*p)[0] = ac.Int(1)
+	*p = Append(ac, *p, ac.Int(2), ac.Int(3))
+	if len(*p) != 3 || *(*p)[2] != 3 {
+		t.Fatalf("len: %v", len(*p))
+	}
+	if ac.checkPointerType(uintptr(unsafe.Pointer(p))) != pointerTypeLacInternal ||
+		ac.checkPointerType(uintptr(unsafe.Pointer(&(*p)[0]))) != pointerTypeLacInternal {
+		t.Errorf("should be allocated from lac")
+	}
+
+	if p := NewSlicePtr[int](nil, 2, 2); len(*p) != 2 {
+		t.Errorf("heap")
+	}
+}
+
+func Test_NewSliceFit(t *testing.T) {
+	p := NewAllocatorPool("fit", nil, 1, 1024, 0, 0)
+	ac := p.Get()
+	defer ac.Release()
+
+	ac.Int(1)
+	s := NewSliceFit[int64](ac, 10)
+	if len(s) != 10 || cap(s) != (1024-ptrSize)/8 || ac.CurrentChunkFree() != (1024-ptrSize)%8 {
+		t.Errorf("len: %v, cap: %v", len(s), cap(s))
+	}
+	// new chunk.
+	if s := NewSliceFit[int64](ac, 200); cap(s) != 200 {
+		t.Errorf("cap: %v", cap(s))
+	}
+	if s := NewSliceFit[int64](nil, 3); len(s) != 3 {
+		t.Errorf("heap")
+	}
+}
+
+func Test_TrimToLen(t *testing.T) {
+	ac := acPool.Get()
+	defer ac.Release()
+
+	s := NewSlice[int](ac, 0, 100)
+	for i := 0; i < 10; i++ {
+		s = Append(ac, s, i)
+	}
+	r := TrimToLen(ac, s)
+	if len(r) != 10 || cap(r) != 10 || &r[0] == &s[0] {
+		t.Fatalf("len: %v, cap: %v", len(r), cap(r))
+	}
+	for i, v := range r {
+		if v != i {
+			t.Errorf("r[%v]: %v", i, v)
+		}
+	}
+	// small slack.
+	if r2 := TrimToLen(ac, s[:90]); &r2[0] != &s[0] || cap(r2) != 100 {
+		t.Errorf("should be no-op")
+	}
+	if r3 := TrimToLen(nil, make([]int, 1, 10)); cap(r3) != 1 {
+		t.Errorf("heap")
+	}
+}
+
+func Test_NewInit(t *testing.T) {
+	ac := acPool.Get()
+	defer ac.Release()
+
+	item := NewInit(ac, func(p *PbItem) {
+		p.Id = ac.Int(1)
+		p.Name = ac.String("init")
+	})
+	if *item.Id != 1 || *item.Name != "init" || item.Class != nil {
+		t.Errorf("item: %+v", item)
+	}
+	noMalloc(func() {
+		NewInit(ac, func(p *PbItem) {
+			p.Id = ac.Int(2)
+		})
+	})
+}
+
+func Test_RegisterInit(t *testing.T) {
+	type withSentinel struct {
+		Id   int
+		Next *withSentinel
+	}
+	RegisterInit(func(p *withSentinel) {
+		p.Id = -1
+	})
+
+	ac := acPool.Get()
+	defer ac.Release()
+
+	if v := New[withSentinel](ac); v.Id != -1 || v.Next != nil {
+		t.Errorf("not initialized: %+v", v)
+	}
+	if v := New[withSentinel](nil); v.Id != -1 {
+		t.Errorf("heap object not initialized: %+v", v)
+	}
+	if v := ac.NewReflect(reflect.TypeOf(withSentinel{})); v.Field(0).Int() != -1 {
+		t.Errorf("reflect not initialized: %+v", v)
+	}
+	if v := New[PbItem](ac); v.Id != nil {
+		t.Errorf("other types should not be affected")
+	}
+	noMalloc(func() {
+		New[withSentinel](ac)
+	})
+
+	RegisterInit[withSentinel](nil)
+	if v := New[withSentinel](ac); v.Id != 0 {
+		t.Errorf("not unregistered: %+v", v)
+	}
+	if typeInits.Load() != nil {
+		t.Errorf("empty registry should be nil")
+	}
+}
+
+func Test_ArenaAliases(t *testing.T) {
+	ac := acPool.Get()
+	defer ac.Release()
+
+	s := MakeSlice[int](ac, 2, 4)
+	v := NewValue[PbItem](ac)
+	if len(s) != 2 || cap(s) != 4 || v == nil ||
+		ac.checkPointerType(uintptr(unsafe.Pointer(v))) != pointerTypeLacInternal {
+		t.Errorf("len: %v, cap: %v", len(s), cap(s))
+	}
+}
+
+func Test_MakeSliceExact(t *testing.T) {
+	ac := acPool.Get()
+	defer ac.Release()
+
+	s := MakeSliceExact[PbItem](ac, 3)
+	if len(s) != 0 || cap(s) != 3 {
+		t.Fatalf("len:%v, cap:%v", len(s), cap(s))
+	}
+	data := (*sliceHeader)(unsafe.Pointer(&s)).Data
+	for i := 0; i < 3; i++ {
+		s = Append(ac, s, PbItem{Id: ac.Int(i)})
+	}
+	if (*sliceHeader)(unsafe.Pointer(&s)).Data != data {
+		t.Errorf("should not realloc")
+	}
+	s = Append(ac, s, PbItem{})
+	if (*sliceHeader)(unsafe.Pointer(&s)).Data == data {
+		t.Errorf("should realloc")
+	}
+	for i := 0; i < 3; i++ {
+		if *s[i].Id != i {
+			t.Fail()
+		}
+	}
+}
+
+func Test_AppendMulti(t *testing.T) {
+	ac := acPool.Get()
+	defer ac.Release()
+
+	s := NewSlice[int](ac, 0, 2)
+	s = Append(ac, s, 1)
+	s = Append(ac, s, 2, 3, 4)
+	if len(s) != 4 || cap(s) < 4 {
+		t.Fatalf("len:%v, cap:%v", len(s), cap(s))
+	}
+	for i, v := range s {
+		if v != i+1 {
+			t.Fail()
+		}
+	}
+}
+
+func Test_AppendUnique(t *testing.T) {
+	ac := acPool.Get()
+	defer ac.Release()
+
+	var s []string
+	for _, v := range []string{"a", "b", "a", "c", "b"} {
+		s = AppendUnique(ac, s, v)
+	}
+	if len(s) != 3 || s[0] != "a" || s[1] != "b" || s[2] != "c" {
+		t.Errorf("%v", s)
+	}
+}
+
+func Test_Flatten(t *testing.T) {
+	acPool.WithDebug(func() {
+		ac := acPool.Get()
+		defer ac.Release()
+
+		for _, ac := range []*Allocator{ac, nil} {
+			var ss [][]*int
+			for i := 0; i < 10; i++ {
+				var s []*int
+				for j := 0; j < i; j++ {
+					s = Append(ac, s, ac.Int(len(ss)*100+j))
+				}
+				ss = append(ss, s)
+			}
+			r := Flatten(ac, ss)
+			runtime.GC()
+			if len(r) != 45 || *r[0] != 100 || *r[44] != 908 {
+				t.Errorf("len: %v", len(r))
+			}
+			if len(Flatten[int](ac, nil)) != 0 {
+				t.Errorf("should be empty")
+			}
+		}
 
-	e := EnumVal2
-	v := NewEnum(ac, e)
-	if *v != e {
-		t.Fail()
-	}
+		// heap elements are attached.
+		type D struct {
+			items []*PbItem
+		}
+		d := New[D](ac)
+		d.items = Flatten(ac, [][]*PbItem{{{Id: new(int)}}, {{Name: new(string)}}})
+		runtime.GC()
+		if d.items[0].Id == nil || d.items[1].Name == nil {
+			t.Errorf("items: %v", d.items)
+		}
+	})
 }
 
-func Test_AttachExternal(b *testing.T) {
+func Test_SetAt(t *testing.T) {
 	ac := acPool.Get()
 	defer ac.Release()
 
-	const sz = 100
-
-	type D struct {
-		d  [sz]*int
-		s  [sz]string
-		ar [sz][]int
+	s := NewSliceFilled[int](ac, 8, -1)[:0]
+	s = SetAt(ac, s, 3, 3)
+	s = SetAt(ac, s, 1, 1)
+	if len(s) != 4 || s[0] != 0 || s[1] != 1 || s[2] != 0 || s[3] != 3 {
+		t.Errorf("%v", s)
 	}
 
-	fail := false
-
-	d := New[D](ac)
-	for i := 0; i < len(d.d); i++ {
-		// pointer
-		if fail {
-			d.d[i] = new(int)
-		} else {
-			d.d[i] = Attach(ac, new(int))
-		}
-		*d.d[i] = i
+	// heap backing with stale pointers beyond len.
+	ps := make([]*int, 4)
+	ps[1] = new(int)
+	ps = SetAt(ac, ps[:0], 2, ps[1])
+	if len(ps) != 3 || ps[0] != nil || ps[1] != nil || ps[2] == nil {
+		t.Errorf("%v", ps)
+	}
 
-		// string
-		if fail {
-			d.s[i] = fmt.Sprintf("%d", i)
-		} else {
-			d.s[i] = Attach(ac, fmt.Sprintf("%d", i))
+	defer func() {
+		if recover() == nil {
+			t.Errorf("should panic")
 		}
+	}()
+	SetAt(ac, s, 8, 8)
+}
 
-		// slice
-		if fail {
-			d.ar[i] = []int{0, 1, 2, 3}
-		} else {
-			d.ar[i] = Attach(ac, []int{0, 1, 2, 3})
-		}
+func Test_AppendGrowLimit(t *testing.T) {
+	maxBytes, step := MaxAllocBytes, SliceGrowStep
+	MaxAllocBytes, SliceGrowStep = 64*1024, 16*1024
+	defer func() {
+		MaxAllocBytes, SliceGrowStep = maxBytes, step
+	}()
 
-		runtime.GC()
-	}
+	ac := acPool.Get()
+	defer ac.Release()
 
-	for i := 0; i < len(d.d); i++ {
-		if *d.d[i] != i {
-			b.Errorf("int should not be gced.")
-		}
-		if d.s[i] != fmt.Sprintf("%d", i) {
-			b.Errorf("string should not be gced.")
-		}
-		if len(d.ar[i]) != 4 {
-			b.Errorf("slice should not be gced.")
-		}
-		for idx, v := range d.ar[i] {
-			if v != idx {
-				b.Errorf("slice gced")
+	type Elem [1024]byte
+	var s []Elem
+	for i := 0; i < 200; i++ {
+		pre := cap(s)
+		s = Append(ac, s, Elem{byte(i)})
+		if c := cap(s); c != pre {
+			if c > MaxAllocBytes/1024 && c > pre+SliceGrowStep/1024 {
+				t.Fatalf("grow too much: %v => %v", pre, c)
 			}
 		}
 	}
+	for i, e := range s {
+		if e[0] != byte(i) {
+			t.Fatalf("content %v", i)
+		}
+	}
 }
 
-func Test_Append(t *testing.T) {
+func Test_AppendBytes(t *testing.T) {
 	ac := acPool.Get()
 	defer ac.Release()
 
-	m := map[int][]int{}
-
-	for i := 0; i < 10; i++ {
-		for j := 0; j < 10; j++ {
-			m[i] = Append(ac, m[i], j)
+	ac.Int(1)
+	var b []byte
+	noMalloc(func() {
+		b = ac.AppendBytes(b, []byte("hello"))
+		b = ac.AppendString(b, ", ")
+		for i := 0; i < 100; i++ {
+			b = ac.AppendString(b, "world")
 		}
+	})
+	if string(b) != "hello, "+strings.Repeat("world", 100) {
+		t.Errorf("content: %s", b)
 	}
 
-	for i := 0; i < 10; i++ {
-		for j := 0; j < 10; j++ {
-			if m[i][j] != j {
-				t.Fail()
-			}
-		}
+	var nilAc *Allocator
+	if s := nilAc.AppendString(nilAc.AppendBytes(nil, []byte("a")), "b"); string(s) != "ab" {
+		t.Fail()
 	}
 }
 
@@ -459,6 +1671,202 @@ func Test_NilAc(t *testing.T) {
 	ac.Release()
 }
 
+func Test_DoubleRelease(t *testing.T) {
+	l := &msgLogger{}
+	p := NewAllocatorPool("double", l, 2, 1024, 0, 0)
+	ac := p.Get()
+	ac.Release()
+	ac.Release()
+	if len(l.msgs) != 1 || !strings.Contains(l.msgs[0], "released twice") {
+		t.Errorf("msgs: %v", l.msgs)
+	}
+
+	ac1 := p.Get()
+	ac2 := p.Get()
+	if ac1 == ac2 {
+		t.Errorf("pool corrupted")
+	}
+	ac1.Release()
+	ac2.Release()
+	if len(l.msgs) != 1 {
+		t.Errorf("msgs: %v", l.msgs)
+	}
+}
+
+func Test_NewReflect(t *testing.T) {
+	acPool.EnableDebugMode(true)
+	defer acPool.EnableDebugMode(false)
+	ac := acPool.Get()
+	defer ac.Release()
+
+	v := ac.NewReflect(reflect.TypeOf(PbItem{}))
+	v.FieldByName("Id").Set(reflect.ValueOf(ac.Int(11)))
+	v.FieldByName("Name").Set(reflect.ValueOf(ac.String("reflect")))
+
+	item := v.Addr().Interface().(*PbItem)
+	if *item.Id != 11 || *item.Name != "reflect" || item.Class != nil {
+		t.Errorf("item: %+v", item)
+	}
+	if ac.checkPointerType(uintptr(unsafe.Pointer(item))) != pointerTypeLacInternal {
+		t.Errorf("should be allocated from lac")
+	}
+	if len(ac.dbgScanObjs.slice) == 0 || ac.dbgScanObjs.slice[len(ac.dbgScanObjs.slice)-1] != any(item) {
+		t.Errorf("should be scanned")
+	}
+
+	var nilAc *Allocator
+	if v := nilAc.NewReflect(reflect.TypeOf(0)); !v.CanSet() {
+		t.Errorf("heap")
+	}
+}
+
+func Test_NewReflectStructOf(t *testing.T) {
+	acPool.EnableDebugMode(true)
+	defer acPool.EnableDebugMode(false)
+	ac := acPool.Get()
+	defer ac.Release()
+
+	tp := reflect.StructOf([]reflect.StructField{
+		{Name: "Id", Type: reflect.TypeOf((*int)(nil))},
+		{Name: "Tags", Type: reflect.TypeOf([]string(nil))},
+		{Name: "Item", Type: reflect.TypeOf((*PbItem)(nil))},
+	})
+	v := ac.NewReflect(tp)
+	v.Field(0).Set(reflect.ValueOf(ac.Int(1)))
+	v.Field(1).Set(reflect.ValueOf(NewSlice[string](ac, 1, 1)))
+	item := New[PbItem](ac)
+	v.Field(2).Set(reflect.ValueOf(item))
+	runtime.GC()
+
+	if *v.Field(0).Interface().(*int) != 1 || ac.checkPointerType(v.Addr().Pointer()) != pointerTypeLacInternal {
+		t.Errorf("value: %v", v)
+	}
+	root := v.Addr().Interface()
+	if err := ac.CheckExternalPointersOf(root); err != nil {
+		t.Errorf("unexpected: %v", err)
+	}
+
+	item.Class = new(int)
+	if err := ac.CheckExternalPointersOf(root); err == nil || !strings.Contains(err.Error(), "Item: PbItem.Class: unexpected external pointer") {
+		t.Errorf("should check the nested fields: %v", err)
+	}
+	item.Class = nil
+
+	v.Field(0).Set(reflect.ValueOf(new(int)))
+	if err := ac.CheckExternalPointersOf(root); err == nil || !strings.Contains(err.Error(), "struct {") {
+		t.Errorf("should name the anonymous type: %v", err)
+	}
+	v.Field(0).Set(reflect.Zero(v.Field(0).Type()))
+}
+
+func Test_NewUninit(t *testing.T) {
+	p := NewAllocatorPool("uninit", nil, 1, 1024, 0, 0)
+	ac := p.Get()
+	NewSliceFilled[byte](ac, 1000, 0xff)
+	ac.Release()
+
+	type D struct {
+		a, b int64
+	}
+	ac = p.Get()
+	defer ac.Release()
+	d := NewUninit[D](ac)
+	if d.a != -1 {
+		t.Errorf("should not be zeroed: %v", *d)
+	}
+	*d = D{1, 2}
+	if nd := NewUninit[D](nil); nd.a != 0 {
+		t.Errorf("heap")
+	}
+}
+
+func Test_NewInterface(t *testing.T) {
+	ac := acPool.Get()
+	defer ac.Release()
+
+	defer func() {
+		err := recover()
+		if err == nil || !strings.Contains(fmt.Sprint(err), "allocate a concrete type and Attach it") {
+			t.Errorf("unexpected: %v", err)
+		}
+	}()
+	New[fmt.Stringer](ac)
+}
+
+func Test_Errorf(t *testing.T) {
+	acPool.EnableDebugMode(true)
+	defer acPool.EnableDebugMode(false)
+	ac := acPool.Get()
+	defer ac.Release()
+
+	err := ac.Errorf("invalid %s: %d", "id", 3)
+	if err.Error() != "invalid id: 3" {
+		t.Errorf("msg: %v", err)
+	}
+	msg := err.Error()
+	if ac.checkPointerType(uintptr((*stringHeader)(unsafe.Pointer(&msg)).Data)) != pointerTypeLacInternal {
+		t.Errorf("msg should be allocated from lac")
+	}
+
+	var nilAc *Allocator
+	if err := nilAc.Errorf("e%d", 1); err.Error() != "e1" {
+		t.Fail()
+	}
+}
+
+func Test_Wrap(t *testing.T) {
+	acPool.EnableDebugMode(true)
+	defer acPool.EnableDebugMode(false)
+	ac := acPool.Get()
+	defer ac.Release()
+
+	cause := errors.New("not found")
+	err := ac.Wrap(ac.Wrap(cause, "load item"), "handle")
+	if err.Error() != "handle: load item: not found" {
+		t.Errorf("msg: %v", err)
+	}
+	if !errors.Is(err, cause) {
+		t.Errorf("should unwrap to the cause")
+	}
+	runtime.GC()
+	if !errors.Is(err, cause) || errors.Unwrap(errors.Unwrap(err)).Error() != "not found" {
+		t.Errorf("cause corrupted")
+	}
+	if ac.Wrap(nil, "x") != nil {
+		t.Errorf("nil")
+	}
+
+	var nilAc *Allocator
+	if err := nilAc.Wrap(cause, "e"); !errors.Is(err, cause) || err.Error() != "e: not found" {
+		t.Errorf("heap: %v", err)
+	}
+}
+
+func Test_DisableAllLac(t *testing.T) {
+	DisableAllLac = true
+	defer func() { DisableAllLac = false }()
+
+	ac := acPool.Get()
+	if ac != nil {
+		t.Fatalf("should be disabled")
+	}
+	defer ac.Release()
+
+	p := new(int)
+	s := make([]int, 1)
+	str := fmt.Sprint(1)
+	f := func() {}
+	noMalloc(func() {
+		_ = Attach(ac, p)
+		_ = Attach(ac, f)
+		_ = AttachSlice(ac, s)
+		_ = ac.NewString(str)
+		ac.keepAlive(p)
+		ac.debugScan(p)
+		ac.CheckNow(p)
+	})
+}
+
 func Test_SliceWrongCap(t *testing.T) {
 	defer func() {
 		if err := recover(); err == nil {
@@ -582,6 +1990,41 @@ func TestSharedAc_NoRace(t *testing.T) {
 	}
 }
 
+func Test_WithAllocator(t *testing.T) {
+	p := NewAllocatorPool("with", nil, 2, 1024, 0, 0)
+
+	var outer, inner *Allocator
+	WithAllocator(p, func(ac *Allocator) {
+		outer = ac
+		ac.IncRef()
+		func() {
+			defer ac.DecRef()
+			inner = ac
+			ac.Int(1)
+		}()
+		if ac.refCnt.Load() != 1 {
+			t.Errorf("nested release")
+		}
+	})
+	if outer != inner || len(p.pool) != 1 {
+		t.Errorf("not released")
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("should panic")
+			}
+		}()
+		WithAllocator(p, func(ac *Allocator) {
+			panic("test")
+		})
+	}()
+	if len(p.pool) != 1 {
+		t.Errorf("not released on panic")
+	}
+}
+
 func TestReinitPool(t *testing.T) {
 	acPool.EnableDebugMode(true)
 
@@ -636,6 +2079,29 @@ func TestReinitPool(t *testing.T) {
 //go:linkname atomicwb runtime.atomicwb
 func atomicwb(ptr *unsafe.Pointer, new unsafe.Pointer)
 
+func Test_Itoa(t *testing.T) {
+	ac := acPool.Get()
+	defer ac.Release()
+
+	for _, i := range []int64{0, 7, -42, 1234567890, math.MaxInt64, math.MinInt64} {
+		if s := ac.Itoa(i); s != strconv.FormatInt(i, 10) {
+			t.Errorf("%v: %v", i, s)
+		}
+	}
+	var s string
+	noMalloc(func() {
+		s = ac.Itoa(-9876)
+	})
+	if s != "-9876" || ac.checkPointerType(uintptr((*stringHeader)(unsafe.Pointer(&s)).Data)) != pointerTypeLacInternal {
+		t.Errorf("should be allocated from lac: %v", s)
+	}
+
+	var nilAc *Allocator
+	if nilAc.Itoa(5) != "5" {
+		t.Errorf("heap")
+	}
+}
+
 func TestNoAlloc(t *testing.T) {
 	ac := acPool.Get()
 	defer ac.DecRef()
@@ -702,3 +2168,156 @@ func TestFreeMarkedObj(t *testing.T) {
 		ac.reset()
 	}
 }
+
+func Test_ShrinkChunks(t *testing.T) {
+	p := NewAllocatorPool("shrink", nil, 1, 64, 0, 0)
+	p.ChunksShrinkCap = 8
+
+	ac := p.Get()
+	for i := 0; i < 100; i++ {
+		NewSlice[byte](ac, 64, 64)
+	}
+	if cap(ac.chunks) <= 8 {
+		t.Fatalf("chunks not grown: %v", cap(ac.chunks))
+	}
+	ac.Release()
+
+	// a normal cycle after the spike.
+	ac = p.Get()
+	ac.Int(1)
+	ac.Release()
+
+	ac = p.Get()
+	defer ac.Release()
+	if c := cap(ac.chunks); c != initChunksCap {
+		t.Errorf("chunks not shrunk: %v", c)
+	}
+}
+
+func Test_InitialChunkSliceCap(t *testing.T) {
+	p := NewAllocatorPool("initChunks", nil, 1, 64, 0, 0)
+	p.InitialChunkSliceCap = 32
+	p.ChunksShrinkCap = 64
+
+	ac := p.Get()
+	if c := cap(ac.chunks); c != 32 {
+		t.Errorf("unexpected cap: %v", c)
+	}
+	for i := 0; i < 20; i++ {
+		NewSlice[byte](ac, 64, 64)
+	}
+	if c := cap(ac.chunks); c != 32 {
+		t.Errorf("chunks should not grow: %v", c)
+	}
+	ac.Release()
+
+	// shrinks to the configured cap.
+	p.ChunksShrinkCap = 8
+	ac = p.Get()
+	for i := 0; i < 200; i++ {
+		NewSlice[byte](ac, 64, 64)
+	}
+	ac.Release()
+	ac = p.Get()
+	ac.Int(1)
+	ac.Release()
+
+	ac = p.Get()
+	defer ac.Release()
+	if c := cap(ac.chunks); c != 32 {
+		t.Errorf("chunks not shrunk to the initial cap: %v", c)
+	}
+}
+
+func Test_SizeFor(t *testing.T) {
+	p := NewAllocatorPool("sizeFor", nil, 1, 64, 0, 0)
+	hooks := 0
+	p.OnPoolMiss = func() { hooks++ }
+	p.OnChunkCreate = func(int) { hooks++ }
+	p.SizeFor(4, 3)
+	if p.chunkPool.Cap != 12 || len(p.chunkPool.pool) != 12 || p.chunkPool.Stats.TotalCreated.Load() != 12 {
+		t.Fatalf("cap: %v, pooled: %v", p.chunkPool.Cap, len(p.chunkPool.pool))
+	}
+	// reserved up front, not missed.
+	if hooks != 0 || p.chunkPool.Stats.Created.Load() != 0 || p.chunkPool.Pool.Stats().Misses != 0 {
+		t.Errorf("hooks: %v, created: %v, misses: %v", hooks, p.chunkPool.Stats.Created.Load(), p.chunkPool.Pool.Stats().Misses)
+	}
+
+	var acs []*Allocator
+	for i := 0; i < 4; i++ {
+		ac := p.Get()
+		for j := 0; j < 3; j++ {
+			NewSlice[byte](ac, 64, 64)
+		}
+		acs = append(acs, ac)
+	}
+	for _, ac := range acs {
+		ac.Release()
+	}
+	if p.chunkPool.Stats.TotalCreated.Load() != 12 || len(p.chunkPool.pool) != 12 || p.chunkPool.DroppedOnPut() != 0 || hooks != 0 {
+		t.Errorf("created: %v, pooled: %v, hooks: %v", p.chunkPool.Stats.TotalCreated.Load(), len(p.chunkPool.pool), hooks)
+	}
+
+	if c := p.Clone("sizeForCloned"); c.chunkPool.Cap != 12 || len(c.chunkPool.pool) != 12 {
+		t.Errorf("not cloned")
+	}
+}
+
+func Test_ClonePool(t *testing.T) {
+	p := NewAllocatorPool("origin", nil, 2, 1024, 3, 4)
+	p.ChunksShrinkCap = 16
+	p.InitialChunkSliceCap = 8
+	p.EnableDebugMode(true)
+
+	c := p.Clone("cloned")
+	if c.Name != "cloned" || c.Pool.Cap != 2 || c.chunkPool.ChunkSize != 1024 ||
+		c.chunkPool.Cap != 4 || len(c.chunkPool.pool) != 3 || c.ChunksShrinkCap != 16 || c.InitialChunkSliceCap != 8 || !c.debugMode {
+		t.Errorf("settings not cloned")
+	}
+	if c.chunkPool == p.chunkPool {
+		t.Errorf("chunk pool should not be shared")
+	}
+
+	ac := c.Get()
+	if ac.acPool != c || ac.chunkPool != c.chunkPool {
+		t.Errorf("allocator from wrong pool")
+	}
+	ac.Release()
+}
+
+func Test_NumaChunkPools(t *testing.T) {
+	p := NewAllocatorPool("numa", nil, 1, 64, 0, 0)
+	p.EnableNumaChunkPools(true)
+	if n := numaNodes(); n > 1 && len(p.numaChunkPools) != n {
+		t.Fatalf("node pools: %v", len(p.numaChunkPools))
+	}
+	if node := currentNumaNode(); node < 0 || node >= numaNodes() {
+		t.Errorf("invalid node: %v", node)
+	}
+
+	// fake 2 nodes on the single node machines.
+	if p.numaChunkPools == nil {
+		p.numaChunkPools = []*ChunkPool{p.chunkPool, newChunkPool("node1", nil, 64, 0, 0)}
+		p.numaChunkPools[1].New = p.chunkPool.New
+	}
+	local := p.localChunkPool()
+
+	ac := p.Get()
+	if ac.chunkPool != local {
+		t.Errorf("not the local pool")
+	}
+	for i := 0; i < 4; i++ {
+		*ac.Int(i) = i
+		NewSlice[byte](ac, 64, 64)
+	}
+	used := len(ac.chunks)
+	ac.Release()
+	if len(local.pool) != used {
+		t.Errorf("chunks not returned to the local pool: %v", len(local.pool))
+	}
+
+	c := p.Clone("numaCloned")
+	if (numaNodes() > 1) != (c.numaChunkPools != nil) {
+		t.Errorf("setting not cloned")
+	}
+}
@@ -0,0 +1,73 @@
+/*
+ * Linear Allocator
+ *
+ * Improve the memory allocation and garbage collection performance.
+ *
+ * Copyright (C) 2020-2023 crazybie@github.com.
+ * https://github.com/crazybie/linear_ac
+ */
+
+package lac
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// BitSet is a fixed size set of bits allocated from Lac, e.g. presence flags over large id ranges.
+// It's pointer-free so never scanned by GC.
+type BitSet struct {
+	words []uint64
+	n     int
+}
+
+func NewBitSet(ac *Allocator, nbits int) *BitSet {
+	b := New[BitSet](ac)
+	// zeroed, NewSlice leaves the pointer-free elements dirty.
+	b.words = AllocObjects[uint64](ac, (nbits+63)/64)
+	b.n = nbits
+	return b
+}
+
+// Len returns the count of bits, not the set ones.
+func (b *BitSet) Len() int {
+	return b.n
+}
+
+func (b *BitSet) Set(i int) {
+	b.check(i)
+	b.words[i/64] |= 1 << (uint(i) % 64)
+}
+
+func (b *BitSet) Clear(i int) {
+	b.check(i)
+	b.words[i/64] &^= 1 << (uint(i) % 64)
+}
+
+func (b *BitSet) Test(i int) bool {
+	b.check(i)
+	return b.words[i/64]&(1<<(uint(i)%64)) != 0
+}
+
+// Range calls f for each set bit in ascending order until f returns false.
+func (b *BitSet) Range(f func(i int) bool) {
+	for wi, w := range b.words {
+		// bits at or beyond n are never set by Set, mask them in case.
+		if rest := b.n - wi*64; rest < 64 {
+			w &= 1<<uint(rest) - 1
+		}
+		for w != 0 {
+			i := wi*64 + bits.TrailingZeros64(w)
+			if !f(i) {
+				return
+			}
+			w &= w - 1
+		}
+	}
+}
+
+func (b *BitSet) check(i int) {
+	if i < 0 || i >= b.n {
+		panic(fmt.Errorf("lac.BitSet: index %v out of range %v", i, b.n))
+	}
+}
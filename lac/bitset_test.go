@@ -0,0 +1,110 @@
+/*
+ * Linear Allocator
+ *
+ * Improve the memory allocation and garbage collection performance.
+ *
+ * Copyright (C) 2020-2023 crazybie@github.com.
+ * https://github.com/crazybie/linear_ac
+ */
+
+package lac
+
+import (
+	"runtime"
+	"testing"
+)
+
+func Test_BitSet(t *testing.T) {
+	ac := acPool.Get()
+	defer ac.Release()
+
+	const n = 5_000_003
+	b := NewBitSet(ac, n)
+	if b.Len() != n {
+		t.Fatalf("len: %v", b.Len())
+	}
+	for i := 0; i < n; i += 7 {
+		b.Set(i)
+	}
+	b.Set(n - 1)
+	runtime.GC()
+
+	for i := 0; i < n; i += 7 * 3 {
+		b.Clear(i)
+	}
+	runtime.GC()
+
+	set := 0
+	for i := 0; i < n; i++ {
+		expected := (i%7 == 0 && i%21 != 0) || i == n-1
+		if b.Test(i) != expected {
+			t.Fatalf("bit %v: expected %v", i, expected)
+		}
+		if expected {
+			set++
+		}
+	}
+
+	cnt, last := 0, -1
+	b.Range(func(i int) bool {
+		if i <= last || !b.Test(i) {
+			t.Fatalf("unexpected bit %v after %v", i, last)
+		}
+		cnt++
+		last = i
+		return true
+	})
+	if cnt != set || last != n-1 {
+		t.Errorf("range: %v, last %v", cnt, last)
+	}
+
+	cnt = 0
+	b.Range(func(i int) bool {
+		cnt++
+		return cnt < 3
+	})
+	if cnt != 3 {
+		t.Errorf("should stop: %v", cnt)
+	}
+}
+
+func Test_BitSetOutOfRange(t *testing.T) {
+	b := NewBitSet(nil, 10)
+	defer func() {
+		if recover() == nil {
+			t.Errorf("should panic")
+		}
+	}()
+	// in the last word but out of range.
+	b.Set(10)
+}
+
+func Test_BitSetDirtyChunk(t *testing.T) {
+	p := NewAllocatorPool("bitset", nil, 1, 4096, 1, 1)
+	ac := p.Get()
+	NewSliceFilled[byte](ac, 4000, 0xff)
+	ac.Release()
+
+	ac = p.Get()
+	defer ac.Release()
+	b := NewBitSet(ac, 1000)
+	cnt := 0
+	b.Range(func(i int) bool {
+		cnt++
+		return true
+	})
+	if cnt != 0 {
+		t.Errorf("stale bits: %v", cnt)
+	}
+
+	// bits beyond n in the last word are not reported.
+	b.words[len(b.words)-1] = ^uint64(0)
+	last := -1
+	b.Range(func(i int) bool {
+		last = i
+		return true
+	})
+	if last != 999 {
+		t.Errorf("last: %v", last)
+	}
+}
@@ -0,0 +1,410 @@
+/*
+ * Linear Allocator
+ *
+ * Improve the memory allocation and garbage collection performance.
+ *
+ * Copyright (C) 2020-2023 crazybie@github.com.
+ * https://github.com/crazybie/linear_ac
+ */
+
+package lac
+
+import (
+	"fmt"
+	"reflect"
+	"unsafe"
+)
+
+// Move deep copies the object graph of obj allocated from src into dst.
+// Only memories from src are copied, external pointers are shared and attached to dst.
+// It is useful for promoting request scoped objects into a long-lived allocator:
+//
+//	cached := lac.Move(cacheAc, ac, obj)
+//	ac.Release()
+//
+// Objects of src are still invalid after src is released, only use the returned one.
+// Boxed values in interfaces are copied too, but pointer-shaped ones referencing src panic.
+// NOTE: interior pointers (pointing into the middle of an object) are copied separately,
+// so they no longer alias the copied object.
+func Move[T any](dst, src *Allocator, obj *T) *T {
+	if obj == nil || (dst == nil && src == nil) {
+		return obj
+	}
+
+	c := &cloneCtx{dst: dst, src: src, visited: map[unsafe.Pointer]unsafe.Pointer{}}
+	r := (*T)(c.clonePtr(unsafe.Pointer(obj), reflect.TypeOf(obj).Elem()))
+	c.flushExternals()
+	return r
+}
+
+// MoveRelease is Move followed by releasing src, so the chunks of src are reused early
+// instead of waiting for the end of its scope, e.g. promoting the survivors of a scratch allocator:
+//
+//	cached := lac.MoveRelease(cacheAc, scratch, obj)
+func MoveRelease[T any](dst, src *Allocator, obj *T) *T {
+	r := Move(dst, src, obj)
+	src.Release()
+	return r
+}
+
+var byteType = reflect.TypeOf(byte(0))
+
+type cloneCtx struct {
+	dst, src *Allocator
+	// src pointer => cloned pointer, keep the sharing and avoid infinite loop.
+	visited map[unsafe.Pointer]unsafe.Pointer
+
+	// externals are kept alive by these slices during cloning,
+	// then put into dst with one lock per queue.
+	ptrs, slices, strs []unsafe.Pointer
+	maps, funcs        []any
+}
+
+func (c *cloneCtx) flushExternals() {
+	if c.dst == nil {
+		return
+	}
+	c.dst.externalPtr.PutAll(c.ptrs)
+	c.dst.externalSlice.PutAll(c.slices)
+	c.dst.externalString.PutAll(c.strs)
+	c.dst.externalMap.PutAll(c.maps)
+	c.dst.externalFunc.PutAll(c.funcs)
+}
+
+func (c *cloneCtx) fromSrc(p unsafe.Pointer) bool {
+	return c.src != nil && p != nil && c.src.checkPointerType(uintptr(p)) == pointerTypeLacInternal
+}
+
+// attach keeps the external memory referenced by val alive in dst.
+func (c *cloneCtx) attach(val reflect.Value) {
+	if c.dst == nil {
+		return
+	}
+	switch val.Kind() {
+	case reflect.Ptr:
+		c.ptrs = append(c.ptrs, val.UnsafePointer())
+	case reflect.Slice:
+		c.slices = append(c.slices, (*sliceHeader)(unsafe.Pointer(val.UnsafeAddr())).Data)
+	case reflect.String:
+		c.strs = append(c.strs, (*stringHeader)(unsafe.Pointer(val.UnsafeAddr())).Data)
+	case reflect.Map:
+		c.maps = append(c.maps, val.UnsafePointer())
+	case reflect.Func:
+		c.funcs = append(c.funcs, interfaceOfUnexported(val))
+	}
+}
+
+// copyMem copies n elems of tp into dst, fallback to typed heap memory if dst is nil.
+func (c *cloneCtx) copyMem(tp reflect.Type, n int, from unsafe.Pointer) unsafe.Pointer {
+	if c.dst != nil {
+		sz := int(tp.Size()) * n
+		p := c.dst.alloc(sz, false)
+		memmoveNoHeapPointers(p, from, uintptr(sz))
+		return p
+	}
+	at := reflect.ArrayOf(n, tp)
+	p := reflect.New(at)
+	p.Elem().Set(reflect.NewAt(at, from).Elem())
+	return p.UnsafePointer()
+}
+
+func (c *cloneCtx) clonePtr(old unsafe.Pointer, tp reflect.Type) unsafe.Pointer {
+	if p, ok := c.visited[old]; ok {
+		return p
+	}
+
+	p := c.copyMem(tp, 1, old)
+	c.visited[old] = p
+
+	v := reflect.NewAt(tp, p)
+	c.fixup(v.Elem())
+	if c.dst != nil && c.dst.acPool.scanObjects() && tp.Kind() == reflect.Struct {
+		c.dst.debugScan(v.Interface())
+	}
+	return p
+}
+
+// fixup clones the memories referenced by the addressable val
+// which is already shallow copied.
+func (c *cloneCtx) fixup(val reflect.Value) {
+	switch val.Kind() {
+	case reflect.Ptr:
+		p := val.UnsafePointer()
+		if p == nil {
+			return
+		}
+		if c.fromSrc(p) {
+			*(*unsafe.Pointer)(unsafe.Pointer(val.UnsafeAddr())) = c.clonePtr(p, val.Type().Elem())
+		} else {
+			c.attach(val)
+		}
+
+	case reflect.Struct:
+		for i := 0; i < val.NumField(); i++ {
+			c.fixup(val.Field(i))
+		}
+
+	case reflect.Array:
+		if !mayContainsPtr(val.Type().Elem().Kind()) {
+			return
+		}
+		for i := 0; i < val.Len(); i++ {
+			c.fixup(val.Index(i))
+		}
+
+	case reflect.Slice:
+		h := (*sliceHeader)(unsafe.Pointer(val.UnsafeAddr()))
+		if h.Data == nil {
+			return
+		}
+		if !c.fromSrc(h.Data) {
+			c.attach(val)
+			return
+		}
+		if h.Len == 0 {
+			h.Data, h.Cap = nil, 0
+			return
+		}
+		elemTp := val.Type().Elem()
+		h.Data = c.copyMem(elemTp, h.Len, h.Data)
+		h.Cap = h.Len
+		if mayContainsPtr(elemTp.Kind()) {
+			for i := 0; i < val.Len(); i++ {
+				c.fixup(val.Index(i))
+			}
+		}
+
+	case reflect.String:
+		h := (*stringHeader)(unsafe.Pointer(val.UnsafeAddr()))
+		if h.Data == nil {
+			return
+		}
+		if !c.fromSrc(h.Data) {
+			c.attach(val)
+		} else if h.Len == 0 {
+			h.Data = nil
+		} else {
+			h.Data = c.copyMem(byteType, h.Len, h.Data)
+		}
+
+	case reflect.Map:
+		if val.IsNil() {
+			return
+		}
+		// bypass the read-only flag of unexported fields.
+		val = reflect.NewAt(val.Type(), unsafe.Pointer(val.UnsafeAddr())).Elem()
+		tp := val.Type()
+		m := reflect.MakeMapWithSize(tp, val.Len())
+		for iter := val.MapRange(); iter.Next(); {
+			k := reflect.New(tp.Key()).Elem()
+			k.Set(iter.Key())
+			c.fixup(k)
+			v := reflect.New(tp.Elem()).Elem()
+			v.Set(iter.Value())
+			c.fixup(v)
+			m.SetMapIndex(k, v)
+		}
+		val.Set(m)
+		c.attach(val)
+
+	case reflect.Func:
+		if !val.IsNil() {
+			c.attach(val)
+		}
+
+	case reflect.Interface:
+		if val.IsNil() {
+			return
+		}
+		e := (*emptyInterface)(unsafe.Pointer(val.UnsafeAddr()))
+		tp := val.Elem().Type()
+		switch {
+		case tp.Kind() == reflect.Ptr:
+			if c.fromSrc(e.Data) {
+				e.Data = c.clonePtr(e.Data, tp.Elem())
+				return
+			}
+		case directIface(tp):
+			// the value itself is stored, e.g. maps and funcs.
+			if c.fromSrc(e.Data) {
+				panic(fmt.Errorf("lac.Move: unsupported %v from src in interface", tp))
+			}
+		case tp.Size() == 0:
+			return
+		case c.fromSrc(e.Data) || mayContainsPtr(tp.Kind()):
+			// the box or the memory referenced by the boxed value may be from src, e.g. strings and slices.
+			e.Data = c.clonePtr(e.Data, tp)
+			return
+		}
+		if c.dst != nil {
+			c.ptrs = append(c.ptrs, e.Data)
+		}
+	}
+}
+
+// directIface reports whether the values of tp are stored in the interface directly instead of boxed,
+// same as the rule of the compiler.
+func directIface(tp reflect.Type) bool {
+	switch tp.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return true
+	case reflect.Array:
+		return tp.Len() == 1 && directIface(tp.Elem())
+	case reflect.Struct:
+		return tp.NumField() == 1 && directIface(tp.Field(0).Type)
+	}
+	return false
+}
+
+// attachFields attaches the external memories referenced by the addressable val itself,
+// without following the pointers, e.g. the elements copied into the Lac memory.
+func (c *cloneCtx) attachFields(val reflect.Value) {
+	switch val.Kind() {
+	case reflect.Struct:
+		for i := 0; i < val.NumField(); i++ {
+			c.attachFields(val.Field(i))
+		}
+
+	case reflect.Array:
+		if !mayContainsPtr(val.Type().Elem().Kind()) {
+			return
+		}
+		for i := 0; i < val.Len(); i++ {
+			c.attachFields(val.Index(i))
+		}
+
+	case reflect.Ptr, reflect.Map:
+		if p := val.UnsafePointer(); p != nil && c.external(p) {
+			c.attach(val)
+		}
+
+	case reflect.Slice:
+		if d := (*sliceHeader)(unsafe.Pointer(val.UnsafeAddr())).Data; d != nil && c.external(d) {
+			c.attach(val)
+		}
+
+	case reflect.String:
+		if d := (*stringHeader)(unsafe.Pointer(val.UnsafeAddr())).Data; d != nil && c.external(d) {
+			c.attach(val)
+		}
+
+	case reflect.Func:
+		if !val.IsNil() {
+			c.attach(val)
+		}
+
+	case reflect.Interface:
+		if d := (*emptyInterface)(unsafe.Pointer(val.UnsafeAddr())).Data; d != nil && c.external(d) {
+			c.ptrs = append(c.ptrs, d)
+		}
+	}
+}
+
+// AttachGraph keeps all the memories reachable from root alive in ac, the bulk counterpart of Attach
+// for referencing a heap object graph from Lac objects without copying, e.g.
+//
+//	lac.AttachGraph(ac, cfg)
+//	obj.Rule = cfg.Rules[0]
+//
+// so any pointer into the graph passes the pointer checker. Memories of ac in the graph are not attached.
+func AttachGraph(ac *Allocator, root any) {
+	if ac == nil || root == nil {
+		return
+	}
+	c := &cloneCtx{dst: ac}
+	c.attachGraph(addressableOf(reflect.ValueOf(root)), map[graphNode]struct{}{})
+	c.flushExternals()
+}
+
+type graphNode struct {
+	p  unsafe.Pointer
+	tp reflect.Type
+}
+
+func (c *cloneCtx) external(p unsafe.Pointer) bool {
+	return c.dst.checkPointerType(uintptr(p)) != pointerTypeLacInternal
+}
+
+// attachGraph attaches the external memories referenced by the addressable val recursively.
+func (c *cloneCtx) attachGraph(val reflect.Value, visited map[graphNode]struct{}) {
+	visit := func(p unsafe.Pointer) bool {
+		n := graphNode{p, val.Type()}
+		if _, ok := visited[n]; ok {
+			return false
+		}
+		visited[n] = struct{}{}
+		return true
+	}
+
+	switch val.Kind() {
+	case reflect.Ptr:
+		p := val.UnsafePointer()
+		if p == nil || !visit(p) {
+			return
+		}
+		if c.external(p) {
+			c.attach(val)
+		}
+		if val.Type().Elem() != reflect.TypeOf(c.dst).Elem() {
+			c.attachGraph(val.Elem(), visited)
+		}
+
+	case reflect.Struct:
+		for i := 0; i < val.NumField(); i++ {
+			c.attachGraph(val.Field(i), visited)
+		}
+
+	case reflect.Array:
+		if !mayContainsPtr(val.Type().Elem().Kind()) {
+			return
+		}
+		for i := 0; i < val.Len(); i++ {
+			c.attachGraph(val.Index(i), visited)
+		}
+
+	case reflect.Slice:
+		h := (*sliceHeader)(unsafe.Pointer(val.UnsafeAddr()))
+		if h.Data == nil || !visit(h.Data) {
+			return
+		}
+		if c.external(h.Data) {
+			c.attach(val)
+		}
+		if mayContainsPtr(val.Type().Elem().Kind()) {
+			for i := 0; i < val.Len(); i++ {
+				c.attachGraph(val.Index(i), visited)
+			}
+		}
+
+	case reflect.String:
+		h := (*stringHeader)(unsafe.Pointer(val.UnsafeAddr()))
+		if h.Data != nil && c.external(h.Data) {
+			c.attach(val)
+		}
+
+	case reflect.Map:
+		if val.IsNil() || !visit(val.UnsafePointer()) {
+			return
+		}
+		c.attach(val)
+		for iter := val.MapRange(); iter.Next(); {
+			c.attachGraph(addressableOf(iter.Key()), visited)
+			c.attachGraph(addressableOf(iter.Value()), visited)
+		}
+
+	case reflect.Func:
+		if !val.IsNil() {
+			c.attach(val)
+		}
+
+	case reflect.Interface:
+		if val.IsNil() {
+			return
+		}
+		// the data of the non-pointer values are boxed, keep the box alive, see NewAnySlice.
+		if d := (*emptyInterface)(unsafe.Pointer(val.UnsafeAddr())).Data; d != nil && c.external(d) {
+			c.ptrs = append(c.ptrs, d)
+		}
+		c.attachGraph(addressableOf(val.Elem()), visited)
+	}
+}
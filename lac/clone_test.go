@@ -0,0 +1,234 @@
+/*
+ * Linear Allocator
+ *
+ * Improve the memory allocation and garbage collection performance.
+ *
+ * Copyright (C) 2020-2023 crazybie@github.com.
+ * https://github.com/crazybie/linear_ac
+ */
+
+package lac
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+)
+
+type cloneNode struct {
+	Name     *string
+	Tags     []string
+	Items    []*PbItem
+	Extern   *int
+	Next     *cloneNode
+	m        map[int]*int
+	ids      [2]*int
+	Any      any
+	Callback func() int
+}
+
+func Test_Move(t *testing.T) {
+	acPool.EnableDebugMode(true)
+	defer acPool.EnableDebugMode(false)
+
+	dst := acPool.Get()
+	defer dst.Release()
+	src := acPool.Get()
+
+	extern := new(int)
+	*extern = 42
+
+	n := New[cloneNode](src)
+	n.Name = src.String("node")
+	n.Tags = Append(src, n.Tags, src.NewString("a"), src.NewString("b"))
+	for i := 0; i < 3; i++ {
+		item := New[PbItem](src)
+		item.Id = src.Int(i)
+		n.Items = Append(src, n.Items, item)
+	}
+	n.Extern = Attach(src, extern)
+	n.Next = New[cloneNode](src)
+	n.m = NewMap[int, *int](src, 1)
+	n.m[1] = src.Int(1)
+	n.ids[1] = src.Int(2)
+	n.Any = New[PbItem](src)
+	n.Callback = Attach(src, func() int { return 3 })
+
+	m := Move(dst, src, n)
+	src.Release()
+	runtime.GC()
+
+	if *m.Name != "node" || len(m.Tags) != 2 || m.Tags[0] != "a" || m.Tags[1] != "b" {
+		t.Errorf("string")
+	}
+	for i, item := range m.Items {
+		if *item.Id != i {
+			t.Errorf("items")
+		}
+	}
+	if m.Extern != extern || m.Next == n.Next {
+		t.Errorf("pointer")
+	}
+	if *m.m[1] != 1 || *m.ids[1] != 2 || m.ids[0] != nil {
+		t.Errorf("map or array")
+	}
+	if _, ok := m.Any.(*PbItem); !ok {
+		t.Errorf("interface")
+	}
+	if m.Callback() != 3 {
+		t.Errorf("func")
+	}
+}
+
+func Test_MoveBoxedInterface(t *testing.T) {
+	// make the dangling ones visible.
+	ZeroMemOnFree = true
+	defer func() { ZeroMemOnFree = false }()
+
+	dst := acPool.Get()
+	defer dst.Release()
+	src := acPool.Get()
+
+	type pair struct {
+		a, b *int
+	}
+	vals := []any{
+		src.NewString("boxed"),
+		Append(src, []*int(nil), src.Int(1)),
+		pair{src.Int(2), src.Int(3)},
+		4,
+	}
+	nodes := make([]*cloneNode, len(vals))
+	for i, v := range vals {
+		n := New[cloneNode](src)
+		n.Any = v
+		nodes[i] = Move(dst, src, n)
+	}
+	src.Release()
+	runtime.GC()
+
+	if s := nodes[0].Any.(string); s != "boxed" {
+		t.Errorf("string: %v", s)
+	}
+	if s := nodes[1].Any.([]*int); len(s) != 1 || *s[0] != 1 {
+		t.Errorf("slice: %v", s)
+	}
+	if p := nodes[2].Any.(pair); *p.a != 2 || *p.b != 3 {
+		t.Errorf("struct: %v", p)
+	}
+	if nodes[3].Any.(int) != 4 {
+		t.Errorf("int")
+	}
+
+	// pointer-shaped values are stored without boxing.
+	src = acPool.Get()
+	defer src.Release()
+	defer func() {
+		if recover() == nil {
+			t.Errorf("should panic")
+		}
+	}()
+	n := New[cloneNode](src)
+	n.Any = struct{ p *int }{src.Int(5)}
+	Move(dst, src, n)
+}
+
+func Test_MoveRelease(t *testing.T) {
+	dst := acPool.Get()
+	defer dst.Release()
+	src := acPool.Get()
+
+	item := New[PbItem](src)
+	item.Id = src.Int(1)
+	m := MoveRelease(dst, src, item)
+	if *m.Id != 1 || !src.released.Load() {
+		t.Errorf("not moved or released")
+	}
+}
+
+func Test_MoveToNil(t *testing.T) {
+	src := acPool.Get()
+
+	d := New[PbData](src)
+	d.Age = src.Int(1)
+	d.Items = Append(src, d.Items, New[PbItem](src))
+	d.Items[0].Name = src.String("item")
+
+	n := New[cloneNode](src)
+	n.Next = n
+
+	m := Move(nil, src, d)
+	mn := Move(nil, src, n)
+	src.Release()
+	runtime.GC()
+
+	if *m.Age != 1 || *m.Items[0].Name != "item" {
+		t.Fail()
+	}
+	if mn.Next != mn {
+		t.Errorf("cycle")
+	}
+}
+
+func Test_AttachGraph(t *testing.T) {
+	type refs struct {
+		Node     *cloneNode
+		Name     *string
+		Tags     []string
+		Tag      string
+		Id       *int
+		Item     *PbItem
+		m        map[int]*int
+		Callback func() int
+	}
+
+	ac := acPool.Get()
+	defer ac.Release()
+
+	// heap graph with a cycle.
+	newNode := func(i int) *cloneNode {
+		n := &cloneNode{Name: new(string), m: map[int]*int{i: new(int)}}
+		*n.Name = fmt.Sprintf("node%d", i)
+		n.Tags = []string{fmt.Sprintf("tag%d", i)}
+		n.Items = []*PbItem{{Id: new(int)}}
+		n.ids[1] = new(int)
+		*n.ids[1] = i
+		n.Any = &PbItem{Class: new(int)}
+		n.Callback = func() int { return i }
+		return n
+	}
+	root := newNode(0)
+	root.Next = newNode(1)
+	root.Next.Next = newNode(2)
+	root.Next.Next.Next = root
+
+	AttachGraph(ac, root)
+	r := New[refs](ac)
+	leaf := root.Next.Next
+	r.Node = leaf
+	r.Name = leaf.Name
+	r.Tags = leaf.Tags
+	r.Tag = leaf.Tags[0]
+	r.Id = leaf.ids[1]
+	r.Item = leaf.Items[0]
+	r.m = leaf.m
+	r.Callback = leaf.Callback
+	root, leaf = nil, nil
+
+	for i := 0; i < 3; i++ {
+		runtime.GC()
+	}
+
+	if *r.Name != "node2" || r.Tag != "tag2" || *r.Id != 2 || r.Callback() != 2 || r.Node.Next.Next.Next != r.Node {
+		t.Errorf("graph: %+v", r)
+	}
+	if err := ac.CheckExternalPointersOf(r); err != nil {
+		t.Errorf("unexpected: %v", err)
+	}
+
+	r.Item = &PbItem{}
+	if err := ac.CheckExternalPointersOf(r); err == nil {
+		t.Errorf("should only attach the graph")
+	}
+	r.Item = nil
+}
@@ -13,6 +13,8 @@ import (
 	"fmt"
 	"math"
 	"reflect"
+	"runtime"
+	"sort"
 	"sync/atomic"
 	"unsafe"
 )
@@ -27,7 +29,13 @@ type ChunkPool struct {
 	ChunkSize int
 	Stats     struct {
 		TotalCreated atomic.Int64
+		// created since the last reset of stats, see AllocatorPool.DumpStats.
+		Created atomic.Int64
 	}
+
+	defaultChunks int
+	// creates a chunk without counting in Stats.Created, see reserve.
+	newChunk func() *sliceHeader
 }
 
 func newChunkPool(name string, logger Logger, chunkSz, defaultChunks, chunksCap int) *ChunkPool {
@@ -38,20 +46,104 @@ func newChunkPool(name string, logger Logger, chunkSz, defaultChunks, chunksCap
 			Equal:  eq[*sliceHeader],
 			Cap:    chunksCap,
 		},
-		ChunkSize: chunkSz,
+		ChunkSize:     chunkSz,
+		defaultChunks: defaultChunks,
 	}
 
-	r.New = func() *sliceHeader {
+	r.newChunk = func() *sliceHeader {
 		c := make(chunk, 0, chunkSz)
 		r.Stats.TotalCreated.Add(1)
 		return (*sliceHeader)(unsafe.Pointer(&c))
 	}
+	r.New = func() *sliceHeader {
+		r.Stats.Created.Add(1)
+		return r.newChunk()
+	}
 
-	r.Reserve(defaultChunks)
+	r.reserve(defaultChunks)
 
 	return r
 }
 
+// reserve replaces the pooled chunks with cnt new ones, counted in Stats.TotalCreated only
+// since they are not created on demand, neither the hooks of AllocatorPool are called.
+func (p *ChunkPool) reserve(cnt int) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	p.pool = make([]*sliceHeader, cnt)
+	for i := 0; i < cnt; i++ {
+		p.newCnt++
+		p.pool[i] = p.newChunk()
+	}
+}
+
+// Large Chunk Pool
+
+// largeChunkPool caches the oversized chunks by size buckets, shared by all allocators of a pool.
+type largeChunkPool struct {
+	// ascending.
+	sizes   []int
+	buckets []*Pool[*sliceHeader]
+}
+
+func newLargeChunkPool(name string, logger Logger, bucketSizes []int, bucketCap int, newChunk func(sz int) *sliceHeader) *largeChunkPool {
+	sizes := append([]int(nil), bucketSizes...)
+	sort.Ints(sizes)
+	r := &largeChunkPool{sizes: sizes}
+	for _, sz := range sizes {
+		sz := sz
+		r.buckets = append(r.buckets, &Pool[*sliceHeader]{
+			Logger: logger,
+			Name:   fmt.Sprintf("LacLargeChunkPool(%s, %d)", name, sz),
+			Equal:  eq[*sliceHeader],
+			Cap:    bucketCap,
+			New: func() *sliceHeader {
+				return newChunk(sz)
+			},
+		})
+	}
+	return r
+}
+
+// get returns a chunk with at least sz bytes from the smallest fitting bucket, nil if no bucket fits.
+func (p *largeChunkPool) get(sz int) *sliceHeader {
+	if i := sort.SearchInts(p.sizes, sz); i < len(p.sizes) {
+		return p.buckets[i].Get()
+	}
+	return nil
+}
+
+// put returns false if ck is not from any bucket or the bucket is full.
+func (p *largeChunkPool) put(ck *sliceHeader) bool {
+	if p == nil {
+		return false
+	}
+	i := sort.SearchInts(p.sizes, ck.Cap)
+	if i == len(p.sizes) || p.sizes[i] != ck.Cap {
+		return false
+	}
+	return p.buckets[i].Put(ck)
+}
+
+func (p *largeChunkPool) stats() (r PoolStats, pooled int) {
+	if p == nil {
+		return
+	}
+	for _, b := range p.buckets {
+		s := b.Stats()
+		r.Gets += s.Gets
+		r.Puts += s.Puts
+		r.Hits += s.Hits
+		r.Misses += s.Misses
+		r.Dropped += s.Dropped
+		b.m.Lock()
+		pooled += len(b.pool)
+		b.m.Unlock()
+	}
+	return
+}
+
 // Allocator Pool
 
 type AllocatorPool struct {
@@ -59,15 +151,61 @@ type AllocatorPool struct {
 	Pool[*Allocator]
 
 	debugMode bool
-	MaxLac    int
-	chunkPool *ChunkPool
-	Name      string
+	// only check external pointers on reset, see EnablePointerCheckOnly.
+	pointerCheck bool
+	MaxLac       int
+	chunkPool    *ChunkPool
+	// nil if not enabled, see EnableLargeChunkPool.
+	largeChunkPool *largeChunkPool
+	largeChunkCap  int
+	// per NUMA node chunk pools indexed by node id, nil if not enabled, see EnableNumaChunkPools.
+	numaChunkPools []*ChunkPool
+	Name           string
+	// wipe the used memory of chunks on reset, so freed data is never readable from the reused chunks.
+	// the buffers served by the heap are wiped too. independent of debug mode.
+	ZeroOnReset bool
+	// allocations larger than this are served by the GC heap instead of the chunks, 0 to disable.
+	// ignored when checking pointers because the checker can only track the chunks.
+	// the buffers are counted in Stats.OutstandingBytes until reset, same as the chunks.
+	HeapFallbackAbove int
+	// shrink the chunks slice of Allocator on reset if its cap exceeds this value
+	// and is much larger than the last usage. 0 to disable.
+	ChunksShrinkCap int
+	// initial cap of the chunks slice of Allocator, set it to the typical chunk usage of a request
+	// to avoid growing the slice repeatedly. 0 for the default.
+	InitialChunkSliceCap int
+	// yield the processor after losing the CAS race on the shared chunk in the multi-thread path,
+	// so a busy goroutine can't starve the others, improves the tail latency under high contention.
+	FairAlloc bool
+	// count the allocations of each Allocator for LastCycleStats, costs an increment per allocation.
+	CountObjects bool
+	// see SetByteBudget.
+	byteBudget atomic.Int64
+
+	// hooks for profiling, e.g. capturing the stack to attribute allocation spikes. nil to disable.
+	// OnChunkCreate is called when a new chunk is created, including the oversized ones.
+	OnChunkCreate func(size int)
+	// OnPoolMiss is called when the chunk pool is empty and has to create a new chunk.
+	OnPoolMiss func()
+	// OnOverBudget is called with the outstanding bytes when a new chunk exceeds the byte budget,
+	// e.g. to signal the handlers to shed load. The allocation still succeeds.
+	OnOverBudget func(outstanding int64)
 
 	Stats struct {
 		TotalCreatedAc atomic.Int64
 		ChunksUsed     atomic.Int64
 		ChunksMiss     atomic.Int64
 		AllocBytes     atomic.Int64
+		// bytes requested by user, AllocBytes minus this is the alignment padding.
+		RequestedBytes atomic.Int64
+		// count of allocations served by the heap, see HeapFallbackAbove.
+		HeapFallbacks atomic.Int64
+		// count of Allocator resets since the last reset of stats.
+		Resets atomic.Int64
+		// bytes of the chunks and heap fallback buffers currently held by the allocators.
+		OutstandingBytes atomic.Int64
+		// count of chunks acquired beyond the byte budget.
+		OverBudget atomic.Int64
 	}
 }
 
@@ -75,9 +213,11 @@ func NewAllocatorPool(name string, logger Logger, lacCap, chunkSz, defaultChunks
 	chunkPool := newChunkPool(name, logger, chunkSz, defaultChunks, chunksCap)
 
 	r := &AllocatorPool{
-		Name:      name,
-		Logger:    logger,
-		chunkPool: chunkPool,
+		Name:                 name,
+		Logger:               logger,
+		chunkPool:            chunkPool,
+		ChunksShrinkCap:      64,
+		InitialChunkSliceCap: initChunksCap,
 		Pool: Pool[*Allocator]{
 			Name:   fmt.Sprintf("LacPool(%s)", name),
 			Cap:    lacCap,
@@ -87,17 +227,195 @@ func NewAllocatorPool(name string, logger Logger, lacCap, chunkSz, defaultChunks
 	}
 	r.Pool.New = func() *Allocator { return newLac(r) }
 
+	newChunk := chunkPool.New
+	chunkPool.New = func() *sliceHeader {
+		if r.OnPoolMiss != nil {
+			r.OnPoolMiss()
+		}
+		if r.OnChunkCreate != nil {
+			r.OnChunkCreate(chunkSz)
+		}
+		return newChunk()
+	}
+
+	return r
+}
+
+// Clone creates a new pool with the same settings,
+// the chunks and allocators are not shared with the original one.
+func (p *AllocatorPool) Clone(name string) *AllocatorPool {
+	if p == nil {
+		return nil
+	}
+	cp := p.chunkPool
+	r := NewAllocatorPool(name, p.Logger, p.Pool.Cap, cp.ChunkSize, cp.defaultChunks, cp.Cap)
+	r.MaxLac = p.MaxLac
+	r.ChunksShrinkCap = p.ChunksShrinkCap
+	r.InitialChunkSliceCap = p.InitialChunkSliceCap
+	r.ZeroOnReset = p.ZeroOnReset
+	r.OnChunkCreate = p.OnChunkCreate
+	r.OnPoolMiss = p.OnPoolMiss
+	r.HeapFallbackAbove = p.HeapFallbackAbove
+	r.FairAlloc = p.FairAlloc
+	r.CountObjects = p.CountObjects
+	r.OnOverBudget = p.OnOverBudget
+	r.byteBudget.Store(p.byteBudget.Load())
+	r.Pool.MaxNew = p.Pool.MaxNew
+	r.chunkPool.MaxNew = cp.MaxNew
+	r.EnableDebugMode(p.debugMode)
+	r.EnablePointerCheckOnly(p.pointerCheck)
+	if p.largeChunkPool != nil {
+		r.EnableLargeChunkPool(p.largeChunkPool.sizes, p.largeChunkCap)
+	}
+	r.EnableNumaChunkPools(p.numaChunkPools != nil)
 	return r
 }
 
+// SizeFor sizes the chunk pool by the intent instead of the chunk counts of NewAllocatorPool:
+// the cap is maxConcurrentAllocators*avgChunksEach, and the chunks are reserved up to the cap,
+// replacing the pooled ones. Like the default chunks of NewAllocatorPool, the reserved ones are counted in
+// the total created chunks only, not as misses, and OnPoolMiss/OnChunkCreate are not called.
+// Must be called before using the pool.
+func (p *AllocatorPool) SizeFor(maxConcurrentAllocators, avgChunksEach int) {
+	n := maxConcurrentAllocators * avgChunksEach
+	cp := p.chunkPool
+	cp.Cap = n
+	cp.defaultChunks = n
+	cp.reserve(n)
+	// created lazily on their nodes, see EnableNumaChunkPools.
+	for _, np := range p.numaChunkPools {
+		np.Cap = n
+	}
+}
+
+// SetByteBudget limits the bytes of the chunks held by all allocators of the pool, 0 to disable.
+// Exceeding it calls OnOverBudget and counts in Stats.OverBudget instead of failing the allocation,
+// check IsOverBudget to apply backpressure before taking more work.
+func (p *AllocatorPool) SetByteBudget(n int64) {
+	p.byteBudget.Store(n)
+}
+
+// IsOverBudget reports whether the outstanding bytes exceed the byte budget.
+func (p *AllocatorPool) IsOverBudget() bool {
+	b := p.byteBudget.Load()
+	return b > 0 && p.Stats.OutstandingBytes.Load() > b
+}
+
+// acquireChunk accounts ck held by an allocator against the byte budget.
+func (p *AllocatorPool) acquireChunk(ck *sliceHeader) {
+	n := p.Stats.OutstandingBytes.Add(int64(ck.Cap))
+	if b := p.byteBudget.Load(); b > 0 && n > b {
+		p.Stats.OverBudget.Add(1)
+		if p.OnOverBudget != nil {
+			p.OnOverBudget(n)
+		}
+	}
+}
+
+// EnableLargeChunkPool caches the oversized chunks(larger than the chunk size) across allocators and resets.
+// The allocation is served by the smallest bucket fitting it, the ones larger than all buckets are not cached.
+// Each bucket keeps at most bucketCap chunks. Must be called before using the pool.
+func (p *AllocatorPool) EnableLargeChunkPool(bucketSizes []int, bucketCap int) {
+	if len(bucketSizes) == 0 {
+		p.largeChunkPool = nil
+		return
+	}
+	p.largeChunkPool = newLargeChunkPool(p.Name, p.Logger, bucketSizes, bucketCap, p.newLargeChunk)
+	p.largeChunkCap = bucketCap
+}
+
+// EnableNumaChunkPools splits the chunk pool per NUMA node on multi-socket Linux servers,
+// an allocator draws the chunks from the pool of the node running the goroutine calling Get.
+// Constraints:
+//   - the Go runtime is not NUMA aware, the chunks are placed by the first-touch policy of the kernel,
+//     i.e. on the node creating them, so they are created lazily instead of reserved by the default chunks.
+//   - goroutines can migrate between cpus, pin the process or threads to get stable locality.
+//   - each node pool keeps at most the chunks cap of the pool.
+//
+// No-op on single node machines and other platforms. Must be called before using the pool.
+func (p *AllocatorPool) EnableNumaChunkPools(v bool) {
+	p.numaChunkPools = nil
+	n := numaNodes()
+	if !v || n <= 1 {
+		return
+	}
+	cp := p.chunkPool
+	pools := make([]*ChunkPool, n)
+	for i := range pools {
+		np := newChunkPool(fmt.Sprintf("%s#node%d", p.Name, i), p.Logger, cp.ChunkSize, 0, cp.Cap)
+		// shares the hooks and stats of the main pool.
+		np.New = cp.New
+		np.MaxNew = cp.MaxNew
+		pools[i] = np
+	}
+	p.numaChunkPools = pools
+}
+
+// localChunkPool returns the chunk pool of the current NUMA node.
+func (p *AllocatorPool) localChunkPool() *ChunkPool {
+	if p.numaChunkPools != nil {
+		if n := currentNumaNode(); n < len(p.numaChunkPools) {
+			return p.numaChunkPools[n]
+		}
+	}
+	return p.chunkPool
+}
+
+// getLargeChunk returns a chunk larger than the chunk size, reused from largeChunkPool if possible.
+func (p *AllocatorPool) getLargeChunk(sz int) *sliceHeader {
+	if p.largeChunkPool != nil {
+		if c := p.largeChunkPool.get(sz); c != nil {
+			return c
+		}
+	}
+	return p.newLargeChunk(sz)
+}
+
+func (p *AllocatorPool) newLargeChunk(sz int) *sliceHeader {
+	if p.OnChunkCreate != nil {
+		p.OnChunkCreate(sz)
+	}
+	// heap allocated chunk is at least ptrSize aligned, same as the normal chunks.
+	c := make(chunk, 0, sz)
+	return (*sliceHeader)(unsafe.Pointer(&c))
+}
+
 // Allocator
 
+const initChunksCap = 4
+
+func (p *AllocatorPool) chunksSliceCap() int {
+	if p.InitialChunkSliceCap > 0 {
+		return p.InitialChunkSliceCap
+	}
+	return initChunksCap
+}
+
+// for assigning Allocator.id.
+var lacIdGen atomic.Uint64
+
 type Allocator struct {
+	// first to be 64bit aligned for the atomic operations on 32bit platforms.
+	// bytes requested before aligning, flushed to pool stats on reset.
+	requested int64
+	// allocations counted if CountObjects is enabled.
+	objects int64
+
+	// unique in the process, for correlating the logs.
+	id         uint64
 	refCnt     atomic.Int32
 	chunks     []*sliceHeader
 	chunkPool  *ChunkPool
 	chunksLock spinLock
 	curChunk   unsafe.Pointer //*sliceHeader
+	// kept alive until reset, see HeapFallbackAbove. guarded by chunksLock.
+	heapBufs []chunk
+	// stats of the cycle ended by the last reset, see LastCycleStats.
+	lastObjects, lastBytes int64
+	// set on reset and renewed for the next cycle, for detecting the slices used after reset, see CheckSlice.
+	dbgReleased *atomic.Bool
+	// guards against returning to the pool twice, see Release.
+	released atomic.Bool
 
 	// Keep a reference back to the pool.
 	// This has two pros:
@@ -116,11 +434,17 @@ type Allocator struct {
 	externalFunc   weakUniqQueue[any]
 
 	dbgScanObjs weakUniqQueue[any]
+	// in debugLacs.
+	dbgRegistered bool
+
+	// objects of Reusable, survive resets.
+	reusables map[string]reusableObj
 }
 
 func newLac(acPool *AllocatorPool) *Allocator {
 	ac := &Allocator{
-		chunks:    make([]*sliceHeader, 0, 4),
+		id:        lacIdGen.Add(1),
+		chunks:    make([]*sliceHeader, 0, acPool.chunksSliceCap()),
 		acPool:    acPool,
 		chunkPool: acPool.chunkPool,
 
@@ -139,6 +463,15 @@ func newLac(acPool *AllocatorPool) *Allocator {
 	return ac
 }
 
+// alignedSize returns the bytes actually taken by an allocation of need bytes.
+func alignedSize(need int) int {
+	if need%ptrSize != 0 {
+		// round up
+		return (need + ptrSize - 1) &^ (ptrSize - 1)
+	}
+	return need
+}
+
 // alloc auto select single-thread or multi-thread algo.
 // multi-thread version uses lock-free algorithm to reduce locking.
 func (ac *Allocator) alloc(need int, zero bool) unsafe.Pointer {
@@ -146,18 +479,22 @@ func (ac *Allocator) alloc(need int, zero bool) unsafe.Pointer {
 		return nil
 	}
 
-	needAligned := need
-	if need%ptrSize != 0 {
-		// round up
-		needAligned = (need + ptrSize + 1) & ^(ptrSize - 1)
+	needAligned := alignedSize(need)
+
+	if n := ac.acPool.HeapFallbackAbove; n > 0 && need > n && !ac.acPool.scanObjects() {
+		return ac.heapAlloc(needAligned)
 	}
 
 	chunkPool := ac.chunkPool
 	var header, new_ *sliceHeader
-	var len_, cap_ int64
+	var len_, cap_ int
 
 	// single-threaded path
 	if ac.refCnt.Load() == 1 {
+		ac.requested += int64(need)
+		if ac.acPool.CountObjects {
+			ac.objects++
+		}
 
 		for {
 			if ac.curChunk != nil {
@@ -166,17 +503,24 @@ func (ac *Allocator) alloc(need int, zero bool) unsafe.Pointer {
 				cap_ = header.Cap
 			}
 
-			if len_+int64(needAligned) > cap_ {
+			if len_+needAligned > cap_ {
 				if needAligned > chunkPool.ChunkSize {
-					t := make(chunk, 0, need)
-					new_ = (*sliceHeader)(unsafe.Pointer(&t))
+					new_ = ac.acPool.getLargeChunk(needAligned)
 				} else {
 					new_ = chunkPool.Get()
 				}
 				ac.curChunk = unsafe.Pointer(new_)
-				ac.chunks = append(ac.chunks, new_)
+				if ac.dbgRegistered {
+					// walked by otherOwnerOf of the other allocators.
+					ac.chunksLock.Lock()
+					ac.chunks = append(ac.chunks, new_)
+					ac.chunksLock.Unlock()
+				} else {
+					ac.chunks = append(ac.chunks, new_)
+				}
+				ac.acPool.acquireChunk(new_)
 			} else {
-				header.Len += int64(needAligned)
+				header.Len += needAligned
 				ptr := unsafe.Add(header.Data, len_)
 				if zero {
 					memclrNoHeapPointers(ptr, uintptr(needAligned))
@@ -187,18 +531,21 @@ func (ac *Allocator) alloc(need int, zero bool) unsafe.Pointer {
 	}
 
 	// multi-threaded path
+	atomic.AddInt64(&ac.requested, int64(need))
+	if ac.acPool.CountObjects {
+		atomic.AddInt64(&ac.objects, 1)
+	}
 	for {
 		cur := atomic.LoadPointer(&ac.curChunk)
 		if cur != nil {
 			header = (*sliceHeader)(cur)
-			len_ = atomic.LoadInt64(&header.Len)
+			len_ = loadLen(header)
 			cap_ = header.Cap
 		}
 
-		if len_+int64(needAligned) > cap_ {
+		if len_+needAligned > cap_ {
 			if needAligned > chunkPool.ChunkSize {
-				t := make(chunk, 0, need)
-				new_ = (*sliceHeader)(unsafe.Pointer(&t))
+				new_ = ac.acPool.getLargeChunk(needAligned)
 			} else {
 				new_ = chunkPool.Get()
 			}
@@ -206,36 +553,70 @@ func (ac *Allocator) alloc(need int, zero bool) unsafe.Pointer {
 				ac.chunksLock.Lock()
 				ac.chunks = append(ac.chunks, new_)
 				ac.chunksLock.Unlock()
-			} else if new_.Cap == int64(chunkPool.ChunkSize) {
+				ac.acPool.acquireChunk(new_)
+			} else if new_.Cap == chunkPool.ChunkSize {
 				chunkPool.Put(new_)
+			} else {
+				ac.acPool.largeChunkPool.put(new_)
 			}
 		} else {
-			if atomic.CompareAndSwapInt64(&header.Len, len_, len_+int64(needAligned)) {
+			if casLen(header, len_, len_+needAligned) {
 				ptr := unsafe.Add(header.Data, len_)
 				if zero {
 					memclrNoHeapPointers(ptr, uintptr(needAligned))
 				}
 				return ptr
 			}
+			if ac.acPool.FairAlloc {
+				runtime.Gosched()
+			}
 		}
 	}
 }
 
+// heapAlloc allocates zeroed memory from the GC heap, kept alive until reset.
+func (ac *Allocator) heapAlloc(sz int) unsafe.Pointer {
+	b := make(chunk, sz)
+	// may be concurrent in the multi-threaded mode.
+	ac.chunksLock.Lock()
+	ac.heapBufs = append(ac.heapBufs, b)
+	ac.chunksLock.Unlock()
+	ac.acPool.acquireChunk((*sliceHeader)(unsafe.Pointer(&b)))
+	ac.acPool.Stats.HeapFallbacks.Add(1)
+	return unsafe.Pointer(&b[0])
+}
+
 func (ac *Allocator) reset() {
+	ac.unregisterDebug()
 	if ac.acPool.debugMode {
 		ac.debugCheck(true)
 		ac.dbgScanObjs.Clear()
+	} else if ac.acPool.pointerCheck {
+		ac.debugCheck(false)
+		ac.dbgScanObjs.Clear()
 	}
 
+	ac.releaseSlices()
 	stats := &ac.acPool.Stats
-
+	stats.Resets.Add(1)
+	stats.RequestedBytes.Add(ac.requested)
+	ac.lastObjects, ac.lastBytes = ac.objects, ac.requested
+	ac.objects, ac.requested = 0, 0
+
+	// reusable chunks are compacted to the front of ac.chunks,
+	// then returned to the pool with one lock.
+	reusable := 0
 	for _, ck := range ac.chunks {
-		stats.AllocBytes.Add(ck.Len)
+		stats.AllocBytes.Add(int64(ck.Len))
+		stats.OutstandingBytes.Add(-int64(ck.Cap))
+		if ac.acPool.ZeroOnReset && ck.Len > 0 {
+			memclrNoHeapPointers(ck.Data, uintptr(ck.Len))
+		}
 		ck.Len = 0
 
 		// only reuse the normal chunks,
 		// otherwise we may have too many large chunks wasted.
-		if ck.Cap == int64(ac.acPool.chunkPool.ChunkSize) {
+		if ck.Cap == ac.chunkPool.ChunkSize {
 			stats.ChunksUsed.Add(1)
 
 			if ac.acPool.debugMode {
@@ -244,22 +625,47 @@ func (ac *Allocator) reset() {
 				if ZeroMemOnFree {
 					memclrNoHeapPointers(ck.Data, uintptr(ck.Cap))
 				}
-				ac.acPool.chunkPool.Put(ck)
+				ac.chunks[reusable] = ck
+				reusable++
 			}
 		} else {
 			if ac.acPool.debugMode {
 				diagnosisChunkPool.Put(ck)
 			} else {
-				// recycle by GC.
+				if ZeroMemOnFree {
+					memclrNoHeapPointers(ck.Data, uintptr(ck.Cap))
+				}
+				// recycle by GC if not cached.
+				ac.acPool.largeChunkPool.put(ck)
 			}
 			stats.ChunksMiss.Add(1)
 		}
 	}
+	if reusable > 0 {
+		ac.chunkPool.PutAll(ac.chunks[:reusable])
+	}
 
 	// clear all ref
-	ac.chunks = resetSlice(ac.chunks)
+	// otherOwnerOf can't reach ac after unregisterDebug, locked anyway to not depend on the order.
+	used := len(ac.chunks)
+	ac.chunksLock.Lock()
+	if n := ac.acPool.ChunksShrinkCap; n > 0 && cap(ac.chunks) > n && used*4 < cap(ac.chunks) {
+		// release the large backing array after a spike.
+		ac.chunks = make([]*sliceHeader, 0, max(used, ac.acPool.chunksSliceCap()))
+	} else {
+		ac.chunks = resetSlice(ac.chunks)
+	}
+	ac.chunksLock.Unlock()
 	ac.curChunk = nil
 
+	for _, b := range ac.heapBufs {
+		stats.OutstandingBytes.Add(-int64(cap(b)))
+		if ac.acPool.ZeroOnReset {
+			memclrNoHeapPointers(unsafe.Pointer(&b[0]), uintptr(len(b)))
+		}
+	}
+	ac.heapBufs = resetSlice(ac.heapBufs)
+
 	// clear externals
 	ac.externalPtr.Clear()
 	ac.externalSlice.Clear()
@@ -267,10 +673,18 @@ func (ac *Allocator) reset() {
 	ac.externalString.Clear()
 	ac.externalFunc.Clear()
 
+	for _, o := range ac.reusables {
+		o.reset()
+	}
+
 	ac.refCnt.Store(1)
 }
 
 func (ac *Allocator) keepAlive(ptr interface{}) {
+	// nil when DisableAllLac, memories are from the native allocator.
+	if ac == nil {
+		return
+	}
 
 	d := data(ptr)
 	if d == nil {
@@ -279,7 +693,7 @@ func (ac *Allocator) keepAlive(ptr interface{}) {
 
 	k := reflect.TypeOf(ptr).Kind()
 	switch k {
-	case reflect.Ptr:
+	case reflect.Ptr, reflect.UnsafePointer:
 		ac.externalPtr.Put(d)
 	case reflect.Slice:
 		ac.externalSlice.Put((*sliceHeader)(d).Data)
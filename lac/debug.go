@@ -10,11 +10,13 @@
 package lac
 
 import (
+	"expvar"
 	"fmt"
 	"math"
 	"reflect"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"unsafe"
 )
 
@@ -23,6 +25,116 @@ import (
 // useful to diagnosis use-after-free bugs.
 var diagnosisChunkPool = sync.Pool{}
 
+// live allocators got in debug mode, for detecting references across allocators.
+var debugLacs = struct {
+	sync.Mutex
+	m map[*Allocator]struct{}
+}{m: map[*Allocator]struct{}{}}
+
+func (ac *Allocator) registerDebug() {
+	debugLacs.Lock()
+	debugLacs.m[ac] = struct{}{}
+	debugLacs.Unlock()
+	ac.dbgRegistered = true
+}
+
+func (ac *Allocator) unregisterDebug() {
+	if !ac.dbgRegistered {
+		return
+	}
+	debugLacs.Lock()
+	delete(debugLacs.m, ac)
+	debugLacs.Unlock()
+	ac.dbgRegistered = false
+}
+
+// slices allocated in debug mode, see CheckSlice.
+// keyed by uintptr to not keep the chunks alive.
+var debugSlices = struct {
+	sync.Mutex
+	m map[uintptr]sliceStamp
+	// drop the stale ones after exceeding this, doubled if most are alive to amortize the sweeping.
+	limit int
+}{m: map[uintptr]sliceStamp{}, limit: 1 << 16}
+
+// references the flag instead of the allocator to not keep the allocators alive.
+type sliceStamp struct {
+	acId     uint64
+	released *atomic.Bool
+}
+
+func (ac *Allocator) stampSlice(data unsafe.Pointer) {
+	debugSlices.Lock()
+	defer debugSlices.Unlock()
+	if len(debugSlices.m) >= debugSlices.limit {
+		// rebuild instead of deleting, maps never shrink.
+		alive := map[uintptr]sliceStamp{}
+		for k, s := range debugSlices.m {
+			if !s.released.Load() {
+				alive[k] = s
+			}
+		}
+		debugSlices.m = alive
+		debugSlices.limit = max(debugSlices.limit, len(alive)*2)
+	}
+	if ac.dbgReleased == nil {
+		ac.dbgReleased = new(atomic.Bool)
+	}
+	debugSlices.m[uintptr(data)] = sliceStamp{ac.id, ac.dbgReleased}
+}
+
+// releaseSlices marks the slices stamped in this cycle as released.
+func (ac *Allocator) releaseSlices() {
+	// nothing stamped, no allocation is concurrent with reset.
+	if ac.dbgReleased == nil {
+		return
+	}
+	debugSlices.Lock()
+	ac.dbgReleased.Store(true)
+	ac.dbgReleased = nil
+	debugSlices.Unlock()
+}
+
+// CheckSlice reports the use of s after the Allocator allocating it is released,
+// e.g. a bare slice returned from a function releasing the allocator, which is not invalidated
+// like the pointers of the scanned objects. Only the slices from NewSlice in debug mode are tracked,
+// and s must start at the beginning of it. Best effort: the stale slices may be forgotten,
+// and a heap slice reusing the address of a collected chunk may be reported.
+func CheckSlice[T any](s []T) error {
+	data := (*sliceHeader)(unsafe.Pointer(&s)).Data
+	if data == nil {
+		return nil
+	}
+	debugSlices.Lock()
+	st, ok := debugSlices.m[uintptr(data)]
+	debugSlices.Unlock()
+	if ok && st.released.Load() {
+		return fmt.Errorf("lac: slice %p of Lac#%d is used after released", data, st.acId)
+	}
+	return nil
+}
+
+// otherOwnerOf returns the other live allocator owning addr, nil if not found.
+// the chunks of others are guarded by their chunksLock while registered.
+func (ac *Allocator) otherOwnerOf(addr uintptr) *Allocator {
+	debugLacs.Lock()
+	defer debugLacs.Unlock()
+	for o := range debugLacs.m {
+		if o == ac {
+			continue
+		}
+		o.chunksLock.Lock()
+		for _, h := range o.chunks {
+			if addr >= uintptr(h.Data) && addr < uintptr(h.Data)+uintptr(h.Cap) {
+				o.chunksLock.Unlock()
+				return o
+			}
+		}
+		o.chunksLock.Unlock()
+	}
+	return nil
+}
+
 func (p *AllocatorPool) EnableDebugMode(v bool) {
 	if p == nil {
 		return
@@ -32,34 +144,147 @@ func (p *AllocatorPool) EnableDebugMode(v bool) {
 	p.chunkPool.CheckDuplication = v
 }
 
+// WithDebug enables debug mode during fn and restores the previous mode after fn returns, even on panic.
+// Allocators must be released inside fn to get checked.
+func (p *AllocatorPool) WithDebug(fn func()) {
+	if p == nil {
+		fn()
+		return
+	}
+	prev := p.debugMode
+	p.EnableDebugMode(true)
+	defer p.EnableDebugMode(prev)
+	fn()
+}
+
+// EnablePointerCheckOnly checks external pointers on reset without other debug features,
+// the pool sizing and chunk recycling are kept the same as release mode,
+// useful for validating in a production-like environment.
+func (p *AllocatorPool) EnablePointerCheckOnly(v bool) {
+	if p == nil {
+		return
+	}
+	p.pointerCheck = v
+}
+
+func (p *AllocatorPool) scanObjects() bool {
+	return p.debugMode || p.pointerCheck
+}
+
 func (p *AllocatorPool) DumpStats(reset bool) string {
 	if p == nil {
 		return "<disabled>"
 	}
 
-	utilization := float64(p.Stats.AllocBytes.Load()) / float64(p.Stats.ChunksUsed.Load()*int64(p.chunkPool.ChunkSize))
+	allocBytes := p.Stats.AllocBytes.Load()
+	requested := p.Stats.RequestedBytes.Load()
+	utilization := float64(allocBytes) / float64(p.Stats.ChunksUsed.Load()*int64(p.chunkPool.ChunkSize))
+	realUtilization := float64(requested) / float64(p.Stats.ChunksUsed.Load()*int64(p.chunkPool.ChunkSize))
+	padding := 0.0
+	if allocBytes > 0 {
+		padding = float64(allocBytes-requested) / float64(allocBytes)
+	}
+	// a spike means the chunk pool is undersized.
+	resets := p.Stats.Resets.Load()
+	chunksPerCycle := float64(p.chunkPool.Stats.Created.Load()) / float64(max(resets, 1))
 
 	s := fmt.Sprintf(`
 [stats]name:%s, chunk_sz:%v,
-[total]new_chunks:%v,new_lacs:%v,
-[chunks]utilization:%.2f, used:%v, miss:%v, pooled:%v,
-[lac]pooled:%v`,
+[total]new_chunks:%v,new_lacs:%v,heap_fallbacks:%v,
+[chunks]utilization:%.2f, real_utilization:%.2f, padding:%.2f, used:%v, miss:%v, pooled:%v, dropped:%v, hit_rate:%.2f,
+[lac]pooled:%v, dropped:%v, hit_rate:%.2f,
+[cycle]resets:%v, created_chunks:%v, new_chunks_per_cycle:%.2f`,
 		p.Name, p.chunkPool.ChunkSize,
-		p.chunkPool.Stats.TotalCreated.Load(), p.Stats.TotalCreatedAc.Load(),
-		utilization, p.Stats.ChunksUsed.Load(), p.Stats.ChunksMiss.Load(), len(p.chunkPool.pool),
-		len(p.pool),
+		p.chunkPool.Stats.TotalCreated.Load(), p.Stats.TotalCreatedAc.Load(), p.Stats.HeapFallbacks.Load(),
+		utilization, realUtilization, padding, p.Stats.ChunksUsed.Load(), p.Stats.ChunksMiss.Load(), len(p.chunkPool.pool), p.chunkPool.DroppedOnPut(), p.chunkPool.Pool.Stats().HitRate(),
+		len(p.pool), p.DroppedOnPut(), p.Pool.Stats().HitRate(),
+		resets, p.chunkPool.Stats.Created.Load(), chunksPerCycle,
 	)
+	if p.largeChunkPool != nil {
+		ls, pooled := p.largeChunkPool.stats()
+		s += fmt.Sprintf(`,
+[large]buckets:%v, reused:%v, created:%v, pooled:%v, dropped:%v`,
+			p.largeChunkPool.sizes, ls.Hits, ls.Misses, pooled, ls.Dropped)
+	}
+	if b := p.byteBudget.Load(); b > 0 {
+		s += fmt.Sprintf(`,
+[budget]bytes:%v, outstanding:%v, over_budget:%v`,
+			b, p.Stats.OutstandingBytes.Load(), p.Stats.OverBudget.Load())
+	}
 	s = strings.ReplaceAll(s, "\n", "")
 
 	if reset {
 		p.Stats.AllocBytes.Store(0)
+		p.Stats.RequestedBytes.Store(0)
 		p.Stats.ChunksUsed.Store(0)
 		p.Stats.ChunksMiss.Store(0)
+		p.Stats.Resets.Store(0)
+		p.chunkPool.Stats.Created.Store(0)
 	}
 
 	return s
 }
 
+// thresholds of Healthy.
+const (
+	unhealthyUtilization = 0.25
+	unhealthyMissRate    = 0.5
+)
+
+// Healthy checks the stats since the last reset for misconfiguration, e.g. for a readiness probe.
+// Returns false with the reason if the chunk size is too large(low utilization)
+// or too small(most chunks are oversized).
+func (p *AllocatorPool) Healthy() (ok bool, reason string) {
+	if p == nil {
+		return true, ""
+	}
+	used, miss := p.Stats.ChunksUsed.Load(), p.Stats.ChunksMiss.Load()
+	if used+miss == 0 {
+		return true, ""
+	}
+	if rate := float64(miss) / float64(used+miss); rate > unhealthyMissRate {
+		return false, fmt.Sprintf("%s: %.0f%% of chunks are oversized, chunk size %v may be too small",
+			p.Name, rate*100, p.chunkPool.ChunkSize)
+	}
+	if used > 0 {
+		utilization := float64(p.Stats.AllocBytes.Load()) / float64(used*int64(p.chunkPool.ChunkSize))
+		if utilization < unhealthyUtilization {
+			return false, fmt.Sprintf("%s: utilization %.2f is low, chunk size %v may be too large",
+				p.Name, utilization, p.chunkPool.ChunkSize)
+		}
+	}
+	return true, ""
+}
+
+// PublishExpvar publishes the stats of p to expvar under name, e.g. shows up at /debug/vars.
+// The stats are computed on reading, panics if name is already published.
+func (p *AllocatorPool) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() any {
+		allocBytes := p.Stats.AllocBytes.Load()
+		chunksUsed := p.Stats.ChunksUsed.Load()
+		utilization := 0.0
+		if chunksUsed > 0 {
+			utilization = float64(allocBytes) / float64(chunksUsed*int64(p.chunkPool.ChunkSize))
+		}
+		return map[string]any{
+			"name":            p.Name,
+			"chunk_size":      p.chunkPool.ChunkSize,
+			"alloc_bytes":     allocBytes,
+			"requested_bytes": p.Stats.RequestedBytes.Load(),
+			"chunks_used":     chunksUsed,
+			"chunks_miss":     p.Stats.ChunksMiss.Load(),
+			"utilization":     utilization,
+			"new_chunks":      p.chunkPool.Stats.TotalCreated.Load(),
+			"new_lacs":        p.Stats.TotalCreatedAc.Load(),
+			"heap_fallbacks":  p.Stats.HeapFallbacks.Load(),
+			"resets":          p.Stats.Resets.Load(),
+			"byte_budget":     p.byteBudget.Load(),
+			"outstanding":     p.Stats.OutstandingBytes.Load(),
+			"over_budget":     p.Stats.OverBudget.Load(),
+		}
+	}))
+}
+
 // DebugCheck check if all items from pool are all returned to pool.
 // useful for leak-checking.
 func (p *AllocatorPool) DebugCheck() {
@@ -79,7 +304,33 @@ func (ac *Allocator) CheckExternalPointers() {
 	ac.debugCheck(false)
 }
 
+// CheckNow checks the external pointers of root immediately and panics on failure,
+// useful for bisecting which assignment introduced the external pointer in the middle of a request.
+func (ac *Allocator) CheckNow(root any) {
+	if err := ac.CheckExternalPointersOf(root); err != nil {
+		panic(err)
+	}
+}
+
+// CheckExternalPointersOf checks the external pointers of the sub graph of root only, without invalidating pointers,
+// much cheaper than CheckExternalPointers for validating a specific structure, e.g. in unit tests.
+func (ac *Allocator) CheckExternalPointersOf(root any) error {
+	if ac == nil {
+		return nil
+	}
+	ctx := newCheckCtx(ac, false)
+	err := ctx.walk(&walkNode{val: reflect.ValueOf(root)})
+	if err != nil {
+		dumpUnsupportedTypes(ac.acPool.Logger, ctx)
+		return fmt.Errorf("Lac#%d: %w", ac.id, err)
+	}
+	return nil
+}
+
 func (ac *Allocator) debugScan(obj any) {
+	if ac == nil {
+		return
+	}
 	ac.dbgScanObjs.Put(obj)
 }
 
@@ -95,8 +346,24 @@ const (
 	pointerTypeLacInternal
 	pointerTypeExternal
 	pointerTypeExternalMarked
+	// dangling after the function returns even marked, e.g. sub-objects of NewFrom made by noescape.
+	pointerTypeStack
 )
 
+func (p pointerType) String() string {
+	switch p {
+	case pointerTypeLacInternal:
+		return "lac-internal"
+	case pointerTypeExternal:
+		return "external"
+	case pointerTypeExternalMarked:
+		return "external-marked"
+	case pointerTypeStack:
+		return "stack"
+	}
+	return "invalid"
+}
+
 func (ac *Allocator) checkPointerType(addr uintptr) pointerType {
 
 	if addr == 0 || addr == nonNilPanickyAddr {
@@ -113,6 +380,10 @@ func (ac *Allocator) checkPointerType(addr uintptr) pointerType {
 		}
 	}
 
+	if onCurrentStack(addr) {
+		return pointerTypeStack
+	}
+
 	for _, c := range ac.externalPtr.slice {
 		if uintptr(c) == addr {
 			return pointerTypeExternalMarked
@@ -121,178 +392,453 @@ func (ac *Allocator) checkPointerType(addr uintptr) pointerType {
 	return pointerTypeExternal
 }
 
+// walkNode is a value met when walking the object graph.
+type walkNode struct {
+	val reflect.Value
+	up  *walkNode
+	// owner and field locate a struct field in up, otherwise val is an element of up at index or key.
+	owner reflect.Type
+	field int
+	index int
+	key   reflect.Value
+	depth int
+	// type of the referenced memory, pointerTypeInvalid for nil references and inline values.
+	pt pointerType
+}
+
+func (n *walkNode) element(val reflect.Value, index int, key reflect.Value) *walkNode {
+	return &walkNode{val: val, up: n, index: index, key: key, depth: n.depth + 1}
+}
+
+// parentKind is the kind of the value containing n, reflect.Invalid for the root.
+func (n *walkNode) parentKind() reflect.Kind {
+	switch {
+	case n.up == nil:
+		return reflect.Invalid
+	case n.owner != nil:
+		return reflect.Struct
+	}
+	return n.up.val.Kind()
+}
+
+// name is the field name or element index in the parent, built lazily since it's only needed on failure and dumping.
+func (n *walkNode) name() string {
+	switch {
+	case n.up == nil:
+		return ""
+	case n.owner != nil:
+		return n.owner.Field(n.field).Name
+	case n.key.IsValid():
+		return fmt.Sprintf("[%v]", n.key)
+	}
+	return fmt.Sprintf("[%d]", n.index)
+}
+
+// path is the qualified path from the root, e.g. "PbData.InUse: PbItem.Class".
+func (n *walkNode) path() string {
+	if n.up == nil {
+		return ""
+	}
+	p := n.up.path()
+	if n.owner == nil {
+		return p + n.name()
+	}
+	if p != "" {
+		p += ": "
+	}
+	// anonymous types, e.g. built by reflect.StructOf.
+	if n.owner.Name() == "" {
+		return fmt.Sprintf("%s(%v).%v", p, n.owner, n.name())
+	}
+	return fmt.Sprintf("%s%v.%v", p, n.owner.Name(), n.name())
+}
+
+func (n *walkNode) errorf(format string, args ...any) error {
+	if n.up == nil {
+		return fmt.Errorf(format, args...)
+	}
+	return fmt.Errorf("%s: %w", n.path(), fmt.Errorf(format, args...))
+}
+
+// graphVisitor is notified of the nodes met by graphWalker, implemented by the pointer checker and DebugDumpGraph.
+type graphVisitor interface {
+	// visit is called before walking into n, a non-nil error stops the walk.
+	visit(n *walkNode) error
+	// leave is called after the children of n are walked.
+	leave(n *walkNode)
+}
+
+type graphWalker struct {
+	ac               *Allocator
+	visitor          graphVisitor
+	visited          map[interface{}]struct{}
+	unsupportedTypes map[string]struct{}
+}
+
+func newGraphWalker(ac *Allocator, v graphVisitor) graphWalker {
+	return graphWalker{
+		ac:               ac,
+		visitor:          v,
+		visited:          map[interface{}]struct{}{},
+		unsupportedTypes: map[string]struct{}{},
+	}
+}
+
+// walk visits n and the objects referenced by it,
+// only the lac-internal memory is walked into, and each struct pointer once.
+func (w *graphWalker) walk(n *walkNode) error {
+	if !n.val.IsValid() {
+		return nil
+	}
+	switch n.val.Kind() {
+	case reflect.Struct, reflect.Array, reflect.Slice, reflect.String, reflect.Interface:
+		// unsafe accessing requires addressable values, e.g. the root or map values,
+		// invalidating pointers in the copy is harmless.
+		n.val = addressableOf(n.val)
+	}
+	n.pt = w.ac.refType(n.val)
+	if err := w.visitor.visit(n); err != nil {
+		return err
+	}
+
+	val := n.val
+	switch val.Kind() {
+	case reflect.Ptr:
+		if err := w.walkPointee(n, val); err != nil {
+			return err
+		}
+
+	case reflect.Interface:
+		// elements of the interface slices, see NewAnySlice.
+		if n.pt == pointerTypeLacInternal && val.Elem().Kind() == reflect.Ptr {
+			if err := w.walkPointee(n, val.Elem()); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Struct:
+		if err := w.walkFields(n, val); err != nil {
+			return err
+		}
+
+	case reflect.Array, reflect.Slice:
+		if val.Kind() == reflect.Slice && n.pt != pointerTypeLacInternal {
+			break
+		}
+		if mayContainsPtr(val.Type().Elem().Kind()) {
+			for i := 0; i < val.Len(); i++ {
+				if err := w.walk(n.element(val.Index(i), i, reflect.Value{})); err != nil {
+					return err
+				}
+			}
+		}
+
+	case reflect.Map:
+		if n.pt != pointerTypeInvalid && mayContainsPtr(val.Type().Elem().Kind()) {
+			for iter := val.MapRange(); iter.Next(); {
+				if err := w.walk(n.element(iter.Value(), 0, iter.Key())); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	w.visitor.leave(n)
+	return nil
+}
+
+// walkPointee walks the fields of the struct pointed by p which is the value of n or held by it.
+func (w *graphWalker) walkPointee(n *walkNode, p reflect.Value) error {
+	if n.pt != pointerTypeLacInternal {
+		return nil
+	}
+	tp := p.Type().Elem()
+	// stop scanning Allocator fields.
+	if tp.Kind() != reflect.Struct || tp == reflect.TypeOf(w.ac).Elem() {
+		return nil
+	}
+	// mark before recursing to support cyclic graphs, e.g. doubly-linked lists.
+	key := interfaceOfUnexported(p)
+	if _, ok := w.visited[key]; ok {
+		return nil
+	}
+	w.visited[key] = struct{}{}
+	return w.walkFields(n, p.Elem())
+}
+
+func (w *graphWalker) walkFields(n *walkNode, val reflect.Value) error {
+	tp := val.Type()
+	for i := 0; i < val.NumField(); i++ {
+		f := val.Field(i)
+		c := &walkNode{val: f, up: n, owner: tp, field: i, depth: n.depth + 1}
+
+		switch f.Kind() {
+		case reflect.Interface, reflect.Chan:
+			msg := fmt.Sprintf("WARNING: pointer checking: unsupported type: %v, %v\n", c.path(), f.String())
+			w.unsupportedTypes[msg] = struct{}{}
+			continue
+		}
+		// uintptr never keeps the memory alive, same as the heap objects.
+		if !mayContainsPtr(f.Kind()) {
+			continue
+		}
+		if err := w.walk(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refType classifies the memory referenced by val, which must be addressable for slices, strings and interfaces.
+// Returns pointerTypeInvalid for nil references and inline values.
+func (ac *Allocator) refType(val reflect.Value) pointerType {
+	switch val.Kind() {
+	case reflect.Ptr, reflect.UnsafePointer:
+		if val.IsNil() || val.Pointer() == nonNilPanickyAddr {
+			return pointerTypeInvalid
+		}
+		return ac.checkPointerType(val.Pointer())
+
+	case reflect.Slice:
+		h := (*sliceHeader)(unsafe.Pointer(val.UnsafeAddr()))
+		if h.Data == nil {
+			return pointerTypeInvalid
+		}
+		pt := ac.checkPointerType(uintptr(h.Data))
+		if pt == pointerTypeExternal {
+			pt = markedType(h.Data, &ac.externalSlice, eq[unsafe.Pointer])
+		}
+		return pt
+
+	case reflect.String:
+		h := (*stringHeader)(unsafe.Pointer(val.UnsafeAddr()))
+		if h.Data == nil {
+			return pointerTypeInvalid
+		}
+		pt := ac.checkPointerType(uintptr(h.Data))
+		if pt == pointerTypeExternal {
+			pt = markedType(h.Data, &ac.externalString, eq[unsafe.Pointer])
+		}
+		return pt
+
+	case reflect.Interface:
+		if val.IsNil() {
+			return pointerTypeInvalid
+		}
+		// same layout for the non-empty interfaces.
+		d := (*emptyInterface)(unsafe.Pointer(val.UnsafeAddr())).Data
+		if d == nil {
+			return pointerTypeInvalid
+		}
+		return ac.checkPointerType(uintptr(d))
+
+	case reflect.Map:
+		if val.IsNil() {
+			return pointerTypeInvalid
+		}
+		return markedType[any](val.UnsafePointer(), &ac.externalMap, func(a, b any) bool { return data(a) == data(b) })
+
+	case reflect.Func:
+		p := interfaceOfUnexported(val)
+		if data(p) == nil {
+			return pointerTypeInvalid
+		}
+		return markedType(p, &ac.externalFunc, interfaceEqual)
+	}
+	return pointerTypeInvalid
+}
+
+// checkCtx is the graphVisitor reporting the unexpected pointers.
 type checkCtx struct {
-	checked            map[interface{}]struct{}
-	unsupportedTypes   map[string]struct{}
+	graphWalker
 	invalidatePointers bool
 }
 
+func newCheckCtx(ac *Allocator, invalidatePointers bool) *checkCtx {
+	ctx := &checkCtx{invalidatePointers: invalidatePointers}
+	ctx.graphWalker = newGraphWalker(ac, ctx)
+	return ctx
+}
+
 // NOTE: all memories must be referenced by structs.
 func (ac *Allocator) debugCheck(invalidatePointers bool) {
-	ctx := &checkCtx{
-		checked:            map[interface{}]struct{}{},
-		unsupportedTypes:   map[string]struct{}{},
-		invalidatePointers: invalidatePointers,
-	}
+	ctx := newCheckCtx(ac, invalidatePointers)
 
 	// reverse order to bypass obfuscated pointers
 	for i := len(ac.dbgScanObjs.slice) - 1; i >= 0; i-- {
 		ptr := ac.dbgScanObjs.slice[i]
-		if _, ok := ctx.checked[ptr]; ok {
+		if _, ok := ctx.visited[ptr]; ok {
 			continue
 		}
-		if err := ac.checkRecursively(reflect.ValueOf(ptr), ctx); err != nil {
+		if err := ctx.walk(&walkNode{val: reflect.ValueOf(ptr)}); err != nil {
 			dumpUnsupportedTypes(ac.acPool.Logger, ctx)
-			panic(err)
+			panic(fmt.Errorf("Lac#%d: %w", ac.id, err))
 		}
 	}
 }
 
-func (ac *Allocator) checkRecursively(val reflect.Value, ctx *checkCtx) error {
-	if val.Kind() == reflect.Ptr {
-		if val.Pointer() != nonNilPanickyAddr && !val.IsNil() {
-			pt := ac.checkPointerType(val.Pointer())
-			if pt == pointerTypeExternal {
-				return fmt.Errorf("unexpected external pointer: %+v", val)
+func (ctx *checkCtx) visit(n *walkNode) error {
+	ac, val, pt := ctx.ac, n.val, n.pt
+	if pt == pointerTypeInvalid {
+		return nil
+	}
+	switch val.Kind() {
+	case reflect.Ptr:
+		if pt != pointerTypeLacInternal {
+			// dangling after the owner resets, even attached.
+			if o := ac.otherOwnerOf(val.Pointer()); o != nil {
+				return n.errorf("unexpected pointer from another allocator Lac#%d: %+v", o.id, val)
 			}
+		}
+		if pt == pointerTypeExternal {
+			return n.errorf("unexpected external pointer: %+v", val)
+		}
+		if pt == pointerTypeStack {
+			return n.errorf("unexpected stack pointer: %+v", val)
+		}
 
-			tp := val.Elem().Type()
-			if tp == reflect.TypeOf(ac).Elem() {
-				// stop scanning Allocator fields.
-				return nil
-			}
+	case reflect.UnsafePointer:
+		// the pointee type is unknown, only check the address itself.
+		if pt == pointerTypeExternal {
+			return n.errorf("unexpected external unsafe.Pointer: %#x", val.Pointer())
+		}
+		if pt == pointerTypeStack {
+			return n.errorf("unexpected stack unsafe.Pointer: %#x", val.Pointer())
+		}
 
-			if pt == pointerTypeLacInternal && tp.Kind() == reflect.Struct {
-				if err := ac.checkRecursively(val.Elem(), ctx); err != nil {
-					return err
-				}
-				ctx.checked[interfaceOfUnexported(val)] = struct{}{}
-			}
+	case reflect.Interface:
+		if pt == pointerTypeExternal {
+			return n.errorf("unexpected external interface data: %v", val.Elem().Type())
+		}
+		if pt == pointerTypeStack {
+			return n.errorf("unexpected stack interface data: %v", val.Elem().Type())
 		}
-		return nil
-	}
 
-	tp := val.Type()
-	fieldName := func(i int) string {
-		return fmt.Sprintf("%v.%v", tp.Name(), tp.Field(i).Name)
-	}
+	case reflect.Slice:
+		if val.Len() == 0 {
+			break
+		}
+		if pt != pointerTypeLacInternal {
+			if o := ac.otherOwnerOf(val.Pointer()); o != nil {
+				return n.errorf("unexpected slice from another allocator Lac#%d: %s", o.id, val.String())
+			}
+		}
+		if pt == pointerTypeExternal {
+			return n.errorf("unexpected external slice: %s", val.String())
+		}
+		if pt == pointerTypeStack {
+			return n.errorf("unexpected stack slice: %s", val.String())
+		}
 
-	if val.Kind() == reflect.Struct {
-		for i := 0; i < val.NumField(); i++ {
-			f := val.Field(i)
+	case reflect.String:
+		if val.Len() == 0 {
+			break
+		}
+		if pt == pointerTypeExternal {
+			return n.errorf("unexpected external string: %s", val.String())
+		}
+		if pt == pointerTypeStack {
+			return n.errorf("unexpected stack string: %s", val.String())
+		}
 
-			switch f.Kind() {
-			case reflect.Bool,
-				reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
-				reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
-				reflect.Float32, reflect.Float64:
-				// no need to check.
+	case reflect.Map:
+		if pt == pointerTypeExternal {
+			return n.errorf("unexpected external map: %+v", val)
+		}
 
-			case reflect.Ptr:
-				if err := ac.checkRecursively(f, ctx); err != nil {
-					return fmt.Errorf("%v: %w", fieldName(i), err)
-				}
-				if ctx.invalidatePointers {
-					*(*uintptr)(unsafe.Pointer(f.UnsafeAddr())) = nonNilPanickyAddr
-				}
+	case reflect.Func:
+		if pt == pointerTypeExternal {
+			return n.errorf("unexpected external func: %s", val.String())
+		}
+	}
+	return nil
+}
 
-			case reflect.Slice:
-				h := (*sliceHeader)(unsafe.Pointer(f.UnsafeAddr()))
-				if f.Len() > 0 && h.Data != nil {
-					found := false
-					for _, s := range ac.externalSlice.slice {
-						if s == h.Data {
-							found = true
-							break
-						}
-					}
-					pt := ac.checkPointerType(uintptr(h.Data))
-					if !found && pt == pointerTypeExternal {
-						return fmt.Errorf("%s: unexpected external slice: %s", fieldName(i), f.String())
-					}
-					if pt == pointerTypeLacInternal {
-						for j := 0; j < f.Len(); j++ {
-							if err := ac.checkRecursively(f.Index(j), ctx); err != nil {
-								return fmt.Errorf("%v: %w", fieldName(i), err)
-							}
-						}
-					}
-				}
-				if ctx.invalidatePointers {
-					h.Data = nil
-					h.Len = math.MaxInt32
-					h.Cap = math.MaxInt32
-				}
+func (ctx *checkCtx) leave(n *walkNode) {
+	// the inline references only, elements of slices are invalidated by the header.
+	if k := n.parentKind(); !ctx.invalidatePointers || (k != reflect.Struct && k != reflect.Array) {
+		return
+	}
+	p := unsafe.Pointer(n.val.UnsafeAddr())
+	switch n.val.Kind() {
+	case reflect.Ptr, reflect.UnsafePointer:
+		*(*uintptr)(p) = nonNilPanickyAddr
+	case reflect.Slice:
+		h := (*sliceHeader)(p)
+		h.Data = nil
+		h.Len = math.MaxInt32
+		h.Cap = math.MaxInt32
+	case reflect.String:
+		h := (*stringHeader)(p)
+		h.Data = nil
+		h.Len = math.MaxInt32
+	}
+}
 
-			case reflect.Array:
-				for j := 0; j < f.Len(); j++ {
-					if err := ac.checkRecursively(f.Index(j), ctx); err != nil {
-						return fmt.Errorf("%v: %w", fieldName(i), err)
-					}
-				}
+// DebugDumpGraph dumps the object graph of root in text with the pointer type of each field,
+// useful to find out where the unexpected external pointer lives. Only available in debug mode.
+func (ac *Allocator) DebugDumpGraph(root any) string {
+	if ac == nil || !ac.acPool.debugMode {
+		return "<debug mode disabled>"
+	}
+	if root == nil {
+		return "<nil>\n"
+	}
+	d := &graphDumper{}
+	w := newGraphWalker(ac, d)
+	_ = w.walk(&walkNode{val: reflect.ValueOf(root)})
+	return d.sb.String()
+}
 
-			case reflect.Map:
-				m := *(*unsafe.Pointer)(unsafe.Pointer(f.UnsafeAddr()))
-				found := false
-				for _, i := range ac.externalMap.slice {
-					if data(i) == m {
-						found = true
-						break
-					}
-				}
-				if !found {
-					return fmt.Errorf("%v: unexpected external map: %+v", fieldName(i), f)
-				}
-				for iter := f.MapRange(); iter.Next(); {
-					if err := ac.checkRecursively(iter.Value(), ctx); err != nil {
-						return fmt.Errorf("%v: %w", fieldName(i), err)
-					}
-				}
+// markedType classifies addr which is not a plain pointer, e.g. data of slices and strings.
+func markedType[T any](addr T, q *weakUniqQueue[T], eq func(a, b T) bool) pointerType {
+	for _, i := range q.slice {
+		if eq(i, addr) {
+			return pointerTypeExternalMarked
+		}
+	}
+	return pointerTypeExternal
+}
 
-			case reflect.String:
-				h := (*stringHeader)(unsafe.Pointer(f.UnsafeAddr()))
-				if f.Len() > 0 && h.Data != nil {
-					found := false
-					for _, s := range ac.externalString.slice {
-						if s == h.Data {
-							found = true
-							break
-						}
-					}
-					pt := ac.checkPointerType(uintptr(h.Data))
-					if !found && pt == pointerTypeExternal {
-						return fmt.Errorf("%s: unexpected external string: %s", fieldName(i), f.String())
-					}
-				}
-				if ctx.invalidatePointers {
-					h.Data = nil
-					h.Len = math.MaxInt32
-				}
+// graphDumper is the graphVisitor printing each node in a line.
+type graphDumper struct {
+	sb strings.Builder
+}
 
-			case reflect.Func:
-				p := interfaceOfUnexported(f)
-				if data(p) != nil {
-					found := false
-					for _, i2 := range ac.externalFunc.slice {
-						if interfaceEqual(i2, p) {
-							found = true
-							break
-						}
-					}
-					if !found {
-						return fmt.Errorf("%s: unexpected external func: %s", fieldName(i), f.String())
-					}
-				}
+func (d *graphDumper) visit(n *walkNode) error {
+	indent := strings.Repeat("  ", n.depth)
+	name := n.name()
+	if name != "" {
+		name += ": "
+	}
+	tp := n.val.Type()
 
-			default:
-				msg := fmt.Sprintf("WARNING: pointer checking: unsupported type: %v, %v\n", fieldName(i), f.String())
-				ctx.unsupportedTypes[msg] = struct{}{}
-			}
+	switch k := n.val.Kind(); {
+	case k == reflect.String || k == reflect.Func:
+		if n.pt != pointerTypeInvalid {
+			fmt.Fprintf(&d.sb, "%s%s%v %v\n", indent, name, tp, n.pt)
 		}
+	case k == reflect.Slice || k == reflect.Map:
+		if n.pt == pointerTypeInvalid {
+			fmt.Fprintf(&d.sb, "%s%s%v nil\n", indent, name, tp)
+		} else {
+			fmt.Fprintf(&d.sb, "%s%s%v %v len=%d\n", indent, name, tp, n.pt, n.val.Len())
+		}
+	case k == reflect.Ptr || k == reflect.UnsafePointer || k == reflect.Interface:
+		if n.pt == pointerTypeInvalid {
+			fmt.Fprintf(&d.sb, "%s%s%v nil\n", indent, name, tp)
+		} else {
+			fmt.Fprintf(&d.sb, "%s%s%v %v\n", indent, name, tp, n.pt)
+		}
+	default:
+		// inline values, e.g. structs and arrays.
+		fmt.Fprintf(&d.sb, "%s%s%v\n", indent, name, tp)
 	}
 	return nil
 }
 
+func (d *graphDumper) leave(*walkNode) {}
+
 var unsupportedTypes = struct {
 	sync.Mutex
 	m map[string]struct{}
@@ -312,3 +858,21 @@ func dumpUnsupportedTypes(l Logger, ctx *checkCtx) {
 	}
 	unsupportedTypes.Unlock()
 }
+
+// types already checked by warnHeapFields.
+var heapFieldsWarned sync.Map
+
+// warnHeapFields logs once per type if t has map/chan/func fields,
+// they are heap backed and must be initialized by NewMap or Attach.
+func warnHeapFields(l Logger, t reflect.Type) {
+	if _, loaded := heapFieldsWarned.LoadOrStore(t, struct{}{}); loaded {
+		return
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		switch f.Type.Kind() {
+		case reflect.Map, reflect.Chan, reflect.Func:
+			warnf(l, "lac: %v.%v is %v, use NewMap or Attach to initialize it\n", t, f.Name, f.Type.Kind())
+		}
+	}
+}
@@ -10,9 +10,13 @@
 package lac
 
 import (
+	"expvar"
+	"fmt"
 	"runtime"
+	"strings"
 	"sync"
 	"testing"
+	"unsafe"
 )
 
 var acPool = NewAllocatorPool("test", nil, 10000, 64*1024, 32*1000, 64*1000)
@@ -99,6 +103,86 @@ func Test_CheckKnownExternalSlice(t *testing.T) {
 	}
 }
 
+func Test_CheckAttachSlice(t *testing.T) {
+	acPool.EnableDebugMode(true)
+	ac := acPool.Get()
+	defer ac.Release()
+
+	defer func() {
+		if err := recover(); err != nil {
+			t.Errorf("faile to check")
+		}
+	}()
+
+	type D struct {
+		v []int
+	}
+	d := New[D](ac)
+	d.v = AttachSlice(ac, make([]int, 3))
+	runtime.GC()
+	d.v[2] = 1
+}
+
+func Test_CheckUnexportedFields(t *testing.T) {
+	type E struct {
+		p *int
+	}
+	type D struct {
+		p  *int
+		ps []*int
+		m  map[int]E
+	}
+
+	cases := map[string]func(ac *Allocator, d *D){
+		"ptr": func(ac *Allocator, d *D) {
+			d.p = new(int)
+		},
+		"slice": func(ac *Allocator, d *D) {
+			d.ps = []*int{ac.Int(1)}
+		},
+		"slice elem": func(ac *Allocator, d *D) {
+			d.ps = NewSlice[*int](ac, 1, 1)
+			d.ps[0] = new(int)
+		},
+		"map value": func(ac *Allocator, d *D) {
+			d.m = NewMap[int, E](ac, 1)
+			d.m[1] = E{p: new(int)}
+		},
+	}
+
+	for name, fn := range cases {
+		func() {
+			acPool.EnableDebugMode(true)
+			defer acPool.EnableDebugMode(false)
+			ac := acPool.Get()
+
+			defer func() {
+				err := recover()
+				if err == nil {
+					t.Errorf("%v: failed to check", name)
+				} else if !strings.Contains(fmt.Sprint(err), "external") {
+					t.Errorf("%v: unexpected error: %v", name, err)
+				}
+			}()
+
+			d := New[D](ac)
+			fn(ac, d)
+			ac.Release()
+		}()
+	}
+
+	// struct values in map are not addressable.
+	acPool.EnableDebugMode(true)
+	defer acPool.EnableDebugMode(false)
+	ac := acPool.Get()
+	d := New[D](ac)
+	d.m = NewMap[int, E](ac, 1)
+	d.m[1] = E{p: ac.Int(1)}
+	d.ps = NewSlice[*int](ac, 1, 1)
+	d.ps[0] = ac.Int(2)
+	ac.Release()
+}
+
 func TestUseAfterFree_Pointer(t *testing.T) {
 	acPool.EnableDebugMode(true)
 	ac := acPool.Get()
@@ -158,6 +242,29 @@ func TestUseAfterFree_Slice(t *testing.T) {
 	d.Items[0] = new(PbItem)
 }
 
+func TestUseAfterFree_Array(t *testing.T) {
+	acPool.EnableDebugMode(true)
+	ac := acPool.Get()
+
+	defer func() {
+		acPool.EnableDebugMode(false)
+		if err := recover(); err == nil {
+			t.Errorf("failed to check")
+		}
+	}()
+
+	type D struct {
+		v [4]*PbItem
+	}
+	d := New[D](ac)
+	FillPtrs(ac, d.v[:])
+	ac.Release()
+
+	if d.v[1].Id == nil {
+		t.Errorf("not panic")
+	}
+}
+
 func Test_WorkWithGc(t *testing.T) {
 	type D struct {
 		v [10]*int
@@ -307,3 +414,543 @@ func Test_ShouldIgnoreFieldsOfMarkedExternal(t *testing.T) {
 	s.sub = Attach(ac, &D{i: new(int)})
 	ac.Release()
 }
+
+func Test_StatsPadding(t *testing.T) {
+	p := NewAllocatorPool("padding", nil, 1, 1024, 1, 1)
+	ac := p.Get()
+	for i := 0; i < 8; i++ {
+		ac.Bool(true)
+	}
+	ac.Release()
+
+	if n := p.Stats.RequestedBytes.Load(); n != 8 {
+		t.Errorf("requested: %v", n)
+	}
+	if n := p.Stats.AllocBytes.Load(); n != 8*int64(ptrSize) {
+		t.Errorf("alloc: %v", n)
+	}
+	if s := p.DumpStats(true); !strings.Contains(s, fmt.Sprintf("padding:%.2f", 1-1/float64(ptrSize))) {
+		t.Errorf("stats: %v", s)
+	}
+	if s := p.DumpStats(false); !strings.Contains(s, "padding:0.00") {
+		t.Errorf("nothing allocated: %v", s)
+	}
+
+	// rounded up to one word only.
+	ac = p.Get()
+	NewSlice[byte](ac, 7, 7)
+	ac.Release()
+	if r, a := p.Stats.RequestedBytes.Load(), p.Stats.AllocBytes.Load(); r != 7 || a != int64(ptrSize) {
+		t.Errorf("requested: %v, alloc: %v", r, a)
+	}
+}
+
+func Test_StatsPerCycle(t *testing.T) {
+	p := NewAllocatorPool("cycle", nil, 1, 1024, 0, 0)
+	for i := 0; i < 4; i++ {
+		ac := p.Get()
+		// 3 chunks in the first cycle, then reused.
+		NewSlice[byte](ac, 3000, 3000)
+		NewSlice[byte](ac, 1000, 1000)
+		NewSlice[byte](ac, 1000, 1000)
+		NewSlice[byte](ac, 1000, 1000)
+		ac.Release()
+	}
+	if s := p.DumpStats(true); !strings.Contains(s, "resets:4, created_chunks:3, new_chunks_per_cycle:0.75") {
+		t.Errorf("stats: %v", s)
+	}
+	if s := p.DumpStats(false); !strings.Contains(s, "resets:0, created_chunks:0,") || p.chunkPool.Stats.TotalCreated.Load() != 3 {
+		t.Errorf("stats not reset: %v", s)
+	}
+}
+
+func Test_Healthy(t *testing.T) {
+	p := NewAllocatorPool("healthy", nil, 1, 1024, 0, 0)
+	if ok, _ := p.Healthy(); !ok {
+		t.Errorf("empty should be healthy")
+	}
+
+	ac := p.Get()
+	NewSlice[byte](ac, 1000, 1000)
+	ac.Release()
+	if ok, reason := p.Healthy(); !ok {
+		t.Errorf("unexpected: %v", reason)
+	}
+
+	// oversized.
+	ac = p.Get()
+	NewSlice[byte](ac, 2000, 2000)
+	NewSlice[byte](ac, 3000, 3000)
+	ac.Release()
+	if ok, reason := p.Healthy(); ok || !strings.Contains(reason, "too small") {
+		t.Errorf("reason: %v", reason)
+	}
+
+	// low utilization.
+	p.DumpStats(true)
+	ac = p.Get()
+	ac.Int(1)
+	ac.Release()
+	if ok, reason := p.Healthy(); ok || !strings.Contains(reason, "is low") {
+		t.Errorf("reason: %v", reason)
+	}
+}
+
+func Test_WithDebug(t *testing.T) {
+	p := NewAllocatorPool("withDebug", nil, 1, 1024, 0, 0)
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("should panic")
+			}
+		}()
+		p.WithDebug(func() {
+			if !p.debugMode {
+				t.Errorf("not enabled")
+			}
+			ac := p.Get()
+			item := New[PbItem](ac)
+			item.Id = new(int)
+			ac.Release()
+		})
+	}()
+	if p.debugMode {
+		t.Errorf("not restored")
+	}
+}
+
+func Test_CheckCrossAllocator(t *testing.T) {
+	acPool.WithDebug(func() {
+		acA := acPool.Get()
+		acB := acPool.Get()
+		defer acB.Release()
+
+		defer func() {
+			err := recover()
+			if err == nil || !strings.Contains(fmt.Sprint(err), fmt.Sprintf("another allocator Lac#%d", acB.ID())) {
+				t.Errorf("failed to check: %v", err)
+			}
+		}()
+
+		type D struct {
+			items []*PbItem
+			item  *PbItem
+		}
+		d := New[D](acA)
+		d.items = Append(acA, d.items, New[PbItem](acA))
+		// attaching doesn't help.
+		d.item = Attach(acA, New[PbItem](acB))
+		acA.Release()
+	})
+}
+
+func Test_CheckCrossAllocatorConcurrent(t *testing.T) {
+	p := NewAllocatorPool("cross", nil, 4, 64, 0, 0)
+	p.EnableDebugMode(true)
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	started := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; ; i++ {
+			ac := p.Get()
+			if i == 0 {
+				close(started)
+			}
+			for j := 0; j < 50; j++ {
+				New[PbItem](ac)
+			}
+			select {
+			case <-stop:
+				ac.Release()
+				return
+			default:
+				ac.Release()
+			}
+		}
+	}()
+
+	<-started
+	for i := 0; i < 1000; i++ {
+		ac := p.Get()
+		item := New[PbItem](ac)
+		item.Id = Attach(ac, new(int))
+		ac.Release()
+	}
+	close(stop)
+	<-done
+}
+
+func Test_PublishExpvar(t *testing.T) {
+	p := NewAllocatorPool("expvar", nil, 1, 1024, 0, 0)
+	p.PublishExpvar("lac_test_expvar")
+	ac := p.Get()
+	ac.Int(1)
+	ac.Release()
+
+	s := expvar.Get("lac_test_expvar").String()
+	if !strings.Contains(s, fmt.Sprintf(`"alloc_bytes":%d`, ptrSize)) || !strings.Contains(s, `"chunks_used":1`) {
+		t.Errorf("vars: %v", s)
+	}
+}
+
+func Test_CheckAppendBacking(t *testing.T) {
+	acPool.WithDebug(func() {
+		ac := acPool.Get()
+		defer ac.Release()
+
+		s := Append(ac, NewSlice[int](ac, 0, 1), 1, 2)
+		s = Append(ac, s, 3)
+		var empty []int
+		empty = Append(ac, empty, 1)
+		attached := AttachSlice(ac, make([]int, 1))
+		attached = Append(ac, attached, 1)
+
+		defer func() {
+			if err := recover(); err == nil || !strings.Contains(fmt.Sprint(err), "not from Lac") {
+				t.Errorf("failed to check: %v", err)
+			}
+		}()
+		Append(ac, make([]int, 1), 2)
+	})
+}
+
+func Test_PointerCheckOnly(t *testing.T) {
+	p := NewAllocatorPool("ptrCheck", nil, 1, 1024, 1, 1)
+	p.EnablePointerCheckOnly(true)
+
+	// chunks go back to the chunk pool like release mode.
+	ac := p.Get()
+	item := New[PbItem](ac)
+	item.Id = ac.Int(1)
+	ac.Release()
+	if len(p.chunkPool.pool) != 1 {
+		t.Errorf("chunk not recycled")
+	}
+	if *item.Id != 1 {
+		t.Errorf("pointers should not be invalidated")
+	}
+
+	defer func() {
+		if err := recover(); err == nil {
+			t.Errorf("failed to check")
+		}
+	}()
+	ac = p.Get()
+	item = New[PbItem](ac)
+	item.Id = new(int)
+	ac.Release()
+}
+
+func Test_DebugDumpGraph(t *testing.T) {
+	acPool.EnableDebugMode(true)
+	ac := acPool.Get()
+	defer ac.Release()
+
+	d := New[PbData](ac)
+	d.Age = Attach(ac, new(int))
+	d.InUse = New[PbItem](ac)
+	d.InUse.Id = ac.Int(1)
+	d.InUse.Class = new(int)
+	d.Items = NewSlice[*PbItem](ac, 1, 1)
+
+	g := ac.DebugDumpGraph(d)
+	for _, l := range []string{
+		"*lac.PbData lac-internal",
+		"  Age: *int external-marked",
+		"  Items: []*lac.PbItem lac-internal len=1",
+		"    [0]: *lac.PbItem nil",
+		"    Id: *int lac-internal",
+		"    Class: *int external\n",
+	} {
+		if !strings.Contains(g, l) {
+			t.Errorf("missing %q in:\n%s", l, g)
+		}
+	}
+	d.InUse.Class = nil
+}
+
+func Test_DebugDumpGraphRoots(t *testing.T) {
+	acPool.EnableDebugMode(true)
+	defer acPool.EnableDebugMode(false)
+	ac := acPool.Get()
+	defer ac.Release()
+
+	type named struct {
+		Name string
+		Ids  []int
+	}
+	v := named{Name: ac.NewString("a"), Ids: NewSlice[int](ac, 1, 1)}
+	items := NewSlice[*PbItem](ac, 1, 1)
+	items[0] = New[PbItem](ac)
+	items[0].Id = ac.Int(1)
+
+	for _, c := range []struct {
+		root  any
+		lines []string
+	}{
+		{nil, []string{"<nil>"}},
+		{(*PbItem)(nil), []string{"*lac.PbItem nil"}},
+		{v, []string{"lac.named\n", "  Name: string lac-internal", "  Ids: []int lac-internal len=1"}},
+		{items, []string{"[]*lac.PbItem lac-internal len=1", "  [0]: *lac.PbItem lac-internal", "    Id: *int lac-internal"}},
+	} {
+		g := ac.DebugDumpGraph(c.root)
+		for _, l := range c.lines {
+			if !strings.Contains(g, l) {
+				t.Errorf("missing %q in:\n%s", l, g)
+			}
+		}
+	}
+}
+
+func Test_CheckNow(t *testing.T) {
+	ac := acPool.Get()
+	defer ac.Release()
+
+	item := New[PbItem](ac)
+	item.Id = ac.Int(1)
+	ac.CheckNow(item)
+
+	defer func() {
+		if err := recover(); err == nil {
+			t.Errorf("failed to check")
+		}
+		item.Class = nil
+	}()
+	item.Class = new(int)
+	ac.CheckNow(item)
+}
+
+func Test_CheckExternalPointersOf(t *testing.T) {
+	ac := acPool.Get()
+	defer ac.Release()
+
+	good := New[PbItem](ac)
+	good.Id = ac.Int(1)
+	bad := New[PbItem](ac)
+	bad.Id = new(int)
+
+	if err := ac.CheckExternalPointersOf(good); err != nil {
+		t.Errorf("unexpected: %v", err)
+	}
+	if err := ac.CheckExternalPointersOf(bad); err == nil || !strings.Contains(err.Error(), "PbItem.Id") ||
+		!strings.HasPrefix(err.Error(), fmt.Sprintf("Lac#%d:", ac.ID())) {
+		t.Errorf("failed to check: %v", err)
+	}
+	bad.Id = nil
+
+	ac2 := acPool.Get()
+	defer ac2.Release()
+	if ac.ID() == 0 || ac2.ID() == ac.ID() {
+		t.Errorf("id: %v, %v", ac.ID(), ac2.ID())
+	}
+}
+
+type msgLogger struct {
+	msgs []string
+}
+
+func (l *msgLogger) Errorf(format string, args ...any) {
+	l.msgs = append(l.msgs, fmt.Sprintf(format, args...))
+}
+
+func Test_WarnHeapFields(t *testing.T) {
+	l := &msgLogger{}
+	p := NewAllocatorPool("warn", l, 1, 1024, 0, 0)
+	p.EnableDebugMode(true)
+
+	type withMap struct {
+		M  map[int]int
+		Ch chan int
+		N  int
+	}
+	ac := p.Get()
+	New[withMap](ac)
+	New[withMap](ac)
+	New[PbItem](ac)
+	ac.Release()
+
+	if len(l.msgs) != 2 || !strings.Contains(l.msgs[0], "withMap.M is map") || !strings.Contains(l.msgs[1], "withMap.Ch is chan") {
+		t.Errorf("msgs: %v", l.msgs)
+	}
+}
+
+func Test_CheckUnsafePointer(t *testing.T) {
+	type raw struct {
+		p    unsafe.Pointer
+		addr uintptr
+	}
+
+	ac := acPool.Get()
+	defer ac.Release()
+
+	r := New[raw](ac)
+	r.p = unsafe.Pointer(ac.Int(1))
+	r.addr = uintptr(r.p)
+	if err := ac.CheckExternalPointersOf(r); err != nil {
+		t.Errorf("unexpected: %v", err)
+	}
+	r.p = unsafe.Pointer(new(int))
+	if err := ac.CheckExternalPointersOf(r); err == nil || !strings.Contains(err.Error(), "raw.p: unexpected external unsafe.Pointer") {
+		t.Errorf("failed to check: %v", err)
+	}
+	r.p = Attach(ac, unsafe.Pointer(new(int)))
+	if err := ac.CheckExternalPointersOf(r); err != nil {
+		t.Errorf("unexpected: %v", err)
+	}
+}
+
+// growStack grows the stack of the current goroutine to keep the addresses on it stable.
+//
+//go:noinline
+func growStack(n int) byte {
+	var buf [1 << 10]byte
+	buf[n%len(buf)] = byte(n)
+	if n == 0 {
+		return buf[0]
+	}
+	return growStack(n-1) + buf[(n+1)%len(buf)]
+}
+
+func Test_CheckStackPointer(t *testing.T) {
+	if runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64" {
+		t.Skip("stack bounds are only read on amd64 and arm64")
+	}
+	growStack(64)
+	ac := acPool.Get()
+	defer ac.Release()
+
+	item := New[PbItem](ac)
+
+	// store the address without escaping, same as the noescape trick warned by NewFrom.
+	local := 1
+	p := &local
+	memmoveNoHeapPointers(unsafe.Pointer(&item.Id), unsafe.Pointer(&p), unsafe.Sizeof(p))
+	if pt := ac.checkPointerType(uintptr(unsafe.Pointer(item.Id))); pt != pointerTypeStack {
+		t.Errorf("unexpected type: %v", pt)
+	}
+	err := ac.CheckExternalPointersOf(item)
+	item.Id = nil
+	if err == nil || !strings.Contains(err.Error(), "PbItem.Id: unexpected stack pointer") {
+		t.Errorf("failed to check: %v", err)
+	}
+
+	// attaching doesn't help.
+	memmoveNoHeapPointers(unsafe.Pointer(&item.Id), unsafe.Pointer(&p), unsafe.Sizeof(p))
+	Attach(ac, item.Id)
+	err = ac.CheckExternalPointersOf(item)
+	item.Id = nil
+	if err == nil || !strings.Contains(err.Error(), "unexpected stack pointer") {
+		t.Errorf("failed to check: %v", err)
+	}
+
+	item.Class = new(int)
+	if pt := ac.checkPointerType(uintptr(unsafe.Pointer(item.Class))); pt != pointerTypeExternal {
+		t.Errorf("heap pointer: %v", pt)
+	}
+	item.Class = nil
+}
+
+func Test_NewAnySlice(t *testing.T) {
+	type container struct {
+		Items []any
+	}
+
+	ac := acPool.Get()
+	defer ac.Release()
+
+	d := New[container](ac)
+	item := New[PbItem](ac)
+	item.Id = ac.Int(2)
+	d.Items = NewAnySlice(ac, []any{new(int), item, nil, "str"})
+	*d.Items[0].(*int) = 1
+	runtime.GC()
+
+	if *d.Items[0].(*int) != 1 || *d.Items[1].(*PbItem).Id != 2 || d.Items[2] != nil || d.Items[3] != "str" {
+		t.Errorf("items: %v", d.Items)
+	}
+	if err := ac.CheckExternalPointersOf(d); err != nil {
+		t.Errorf("unexpected: %v", err)
+	}
+
+	item.Class = new(int)
+	if err := ac.CheckExternalPointersOf(d); err == nil || !strings.Contains(err.Error(), "PbItem.Class") {
+		t.Errorf("should check the elements recursively: %v", err)
+	}
+	item.Class = nil
+
+	d.Items[0] = new(int)
+	if err := ac.CheckExternalPointersOf(d); err == nil || !strings.Contains(err.Error(), "unexpected external interface data: *int") {
+		t.Errorf("failed to check: %v", err)
+	}
+	d.Items[0] = nil
+}
+
+func Test_CheckSlice(t *testing.T) {
+	acPool.EnableDebugMode(true)
+	defer acPool.EnableDebugMode(false)
+
+	leak := func() []int {
+		ac := acPool.Get()
+		defer ac.Release()
+		return NewSlice[int](ac, 10, 10)
+	}
+
+	ac := acPool.Get()
+	live := NewSlice[int](ac, 10, 10)
+	if err := CheckSlice(live); err != nil {
+		t.Errorf("unexpected: %v", err)
+	}
+	stale := leak()
+	if err := CheckSlice(stale); err == nil || !strings.Contains(err.Error(), "used after released") {
+		t.Errorf("failed to check: %v", err)
+	}
+	ac.Release()
+	if err := CheckSlice(live); err == nil {
+		t.Errorf("should be stale after release")
+	}
+
+	// still stale after the allocator is reused.
+	ac = acPool.Get()
+	defer ac.Release()
+	if err := CheckSlice(stale); err == nil {
+		t.Errorf("should be stale after reused")
+	}
+	if CheckSlice([]int{1}) != nil || CheckSlice[int](nil) != nil {
+		t.Errorf("untracked")
+	}
+}
+
+func Test_ScopedDebugMode(t *testing.T) {
+	acPool.EnableDebugMode(true)
+	defer acPool.EnableDebugMode(false)
+
+	type Item struct{ P *int }
+	ac := acPool.Get()
+	ac.Int(0)
+	Scoped(ac, 1, func(s []uintptr) {
+		it := New[Item](ac)
+		it.P = ac.Int(1)
+	})
+	// reusing the scoped memory would leave a garbage pointer in the tracked Item.
+	NewSliceFilled[uintptr](ac, 8, 0xdeadbeef)
+	ac.Release()
+}
+
+func Test_FreeLastDebugMode(t *testing.T) {
+	acPool.EnableDebugMode(true)
+	defer acPool.EnableDebugMode(false)
+
+	type Item struct{ P *int }
+	ac := acPool.Get()
+	p := ac.Int(1)
+	it := New[Item](ac)
+	it.P = p
+	if ac.FreeLast(unsafe.Pointer(it), int(unsafe.Sizeof(*it))) {
+		t.Errorf("should not free when checking pointers")
+	}
+	// reusing the freed memory would leave a garbage pointer in the tracked Item.
+	NewSliceFilled[uintptr](ac, 8, 0xdeadbeef)
+	ac.Release()
+}
@@ -0,0 +1,92 @@
+/*
+ * Linear Allocator
+ *
+ * Improve the memory allocation and garbage collection performance.
+ *
+ * Copyright (C) 2020-2023 crazybie@github.com.
+ * https://github.com/crazybie/linear_ac
+ */
+
+package lac
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+type lacError struct {
+	msg string
+}
+
+func (e *lacError) Error() string {
+	return e.msg
+}
+
+// bytesWriter appends into the allocator, allocated from lac to avoid escaping to heap.
+type bytesWriter struct {
+	ac  *Allocator
+	buf []byte
+}
+
+func (w *bytesWriter) Write(p []byte) (int, error) {
+	w.buf = w.ac.AppendBytes(w.buf, p)
+	return len(p), nil
+}
+
+// Errorf formats the message into lac and returns an error allocated from lac.
+// The returned error becomes invalid after ac is released, never keep it longer than ac.
+// %w is not supported, use fmt.Errorf instead if the cause is needed.
+func (ac *Allocator) Errorf(format string, args ...any) error {
+	if ac == nil {
+		return fmt.Errorf(format, args...)
+	}
+
+	e := New[lacError](ac)
+	e.msg = ac.sprintf(format, args...)
+	return e
+}
+
+// sprintf formats the message into lac.
+func (ac *Allocator) sprintf(format string, args ...any) (r string) {
+	w := New[bytesWriter](ac)
+	w.ac = ac
+	fmt.Fprintf(w, format, args...)
+
+	h := (*stringHeader)(unsafe.Pointer(&r))
+	h.Data = (*sliceHeader)(unsafe.Pointer(&w.buf)).Data
+	h.Len = len(w.buf)
+	return
+}
+
+type lacWrapError struct {
+	msg   string
+	cause error
+}
+
+func (e *lacWrapError) Error() string {
+	return e.msg
+}
+
+func (e *lacWrapError) Unwrap() error {
+	return e.cause
+}
+
+// Wrap returns an error allocated from lac with the message "msg: err" and err as the cause,
+// errors.Is and errors.As work through Unwrap. err is kept alive until ac is released.
+// The returned error becomes invalid after ac is released, never keep it longer than ac.
+func (ac *Allocator) Wrap(err error, msg string) error {
+	if err == nil {
+		return nil
+	}
+	if ac == nil {
+		return fmt.Errorf("%s: %w", msg, err)
+	}
+
+	// not tracked by the checker which doesn't support interfaces,
+	// err may be heap allocated and is kept alive explicitly.
+	e := (*lacWrapError)(ac.alloc(int(unsafe.Sizeof(lacWrapError{})), true))
+	e.msg = ac.sprintf("%s: %v", msg, err)
+	ac.externalPtr.Put(data(err))
+	e.cause = err
+	return e
+}
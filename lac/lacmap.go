@@ -0,0 +1,156 @@
+/*
+ * Linear Allocator
+ *
+ * Improve the memory allocation and garbage collection performance.
+ *
+ * Copyright (C) 2020-2023 crazybie@github.com.
+ * https://github.com/crazybie/linear_ac
+ */
+
+package lac
+
+import (
+	"reflect"
+	"time"
+	"unsafe"
+)
+
+// LacMap is an open-addressing hash map allocated from Lac,
+// unlike NewMap all buckets live in Lac so the GC never scans them.
+// The old buckets are not reclaimed on growing until the Allocator is released,
+// so reserve enough capacity to avoid wasting memory.
+// Same as other Lac objects, external pointers stored in it must be attached.
+type LacMap[K comparable, V any] struct {
+	ac    *Allocator
+	slots []mapSlot[K, V]
+	len   int
+	// used slots including deleted ones.
+	used int
+}
+
+const (
+	slotEmpty uint8 = iota
+	slotUsed
+	slotDeleted
+)
+
+type mapSlot[K comparable, V any] struct {
+	key   K
+	val   V
+	state uint8
+}
+
+var mapSeed = uintptr(time.Now().UnixNano())
+
+func NewLacMap[K comparable, V any](ac *Allocator, cap int) *LacMap[K, V] {
+	m := New[LacMap[K, V]](ac)
+	m.ac = ac
+	n := 8
+	for n*3 < cap*4 {
+		n *= 2
+	}
+	m.slots = NewSlice[mapSlot[K, V]](ac, n, n)
+	return m
+}
+
+func (m *LacMap[K, V]) Len() int {
+	return m.len
+}
+
+func (m *LacMap[K, V]) hash(k *K) uintptr {
+	tp := reflect.TypeOf(k).Elem()
+	return typehash(data(tp), unsafe.Pointer(k), mapSeed)
+}
+
+// find returns the slot index of k, or the slot to insert k with ok=false.
+func (m *LacMap[K, V]) find(k K) (idx int, ok bool) {
+	mask := len(m.slots) - 1
+	idx = -1
+	for i := int(m.hash(&k)) & mask; ; i = (i + 1) & mask {
+		s := &m.slots[i]
+		switch s.state {
+		case slotEmpty:
+			if idx < 0 {
+				idx = i
+			}
+			return idx, false
+		case slotDeleted:
+			if idx < 0 {
+				idx = i
+			}
+		default:
+			if s.key == k {
+				return i, true
+			}
+		}
+	}
+}
+
+func (m *LacMap[K, V]) Get(k K) (v V, ok bool) {
+	if i, ok := m.find(k); ok {
+		return m.slots[i].val, true
+	}
+	return
+}
+
+func (m *LacMap[K, V]) Set(k K, v V) {
+	i, ok := m.find(k)
+	if ok {
+		m.slots[i].val = v
+		return
+	}
+
+	s := &m.slots[i]
+	if s.state == slotEmpty {
+		if (m.used+1)*4 > len(m.slots)*3 {
+			m.grow()
+			m.Set(k, v)
+			return
+		}
+		m.used++
+	}
+	s.key = k
+	s.val = v
+	s.state = slotUsed
+	m.len++
+}
+
+func (m *LacMap[K, V]) Delete(k K) bool {
+	i, ok := m.find(k)
+	if !ok {
+		return false
+	}
+	var zero mapSlot[K, V]
+	m.slots[i] = zero
+	m.slots[i].state = slotDeleted
+	m.len--
+	return true
+}
+
+// Range calls f for each entry until f returns false.
+func (m *LacMap[K, V]) Range(f func(k K, v V) bool) {
+	for i := range m.slots {
+		if s := &m.slots[i]; s.state == slotUsed {
+			if !f(s.key, s.val) {
+				return
+			}
+		}
+	}
+}
+
+func (m *LacMap[K, V]) grow() {
+	old := m.slots
+	n := len(old)
+	// only rehash if there are too many deleted slots.
+	if m.len*2 >= n {
+		n *= 2
+	}
+	m.slots = NewSlice[mapSlot[K, V]](m.ac, n, n)
+	m.len = 0
+	m.used = 0
+	for i := range old {
+		if s := &old[i]; s.state == slotUsed {
+			m.Set(s.key, s.val)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+/*
+ * Linear Allocator
+ *
+ * Improve the memory allocation and garbage collection performance.
+ *
+ * Copyright (C) 2020-2023 crazybie@github.com.
+ * https://github.com/crazybie/linear_ac
+ */
+
+package lac
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+)
+
+func Test_LacMap(t *testing.T) {
+	acPool.EnableDebugMode(true)
+	defer acPool.EnableDebugMode(false)
+	ac := acPool.Get()
+	defer ac.Release()
+
+	type D struct {
+		m *LacMap[string, *PbItem]
+	}
+	d := New[D](ac)
+	d.m = NewLacMap[string, *PbItem](ac, 0)
+
+	const n = 1000
+	for i := 0; i < n; i++ {
+		item := New[PbItem](ac)
+		item.Id = ac.Int(i)
+		d.m.Set(ac.NewString(fmt.Sprintf("k%d", i)), item)
+		if i%100 == 0 {
+			runtime.GC()
+		}
+	}
+	if d.m.Len() != n {
+		t.Fatalf("len: %v", d.m.Len())
+	}
+
+	for i := 0; i < n; i += 2 {
+		if !d.m.Delete(fmt.Sprintf("k%d", i)) {
+			t.Errorf("delete %v", i)
+		}
+	}
+	if d.m.Delete("k0") {
+		t.Errorf("deleted twice")
+	}
+	// reuse deleted slots.
+	for i := 0; i < n; i += 4 {
+		d.m.Set(ac.NewString(fmt.Sprintf("k%d", i)), nil)
+	}
+
+	for i := 0; i < n; i++ {
+		v, ok := d.m.Get(fmt.Sprintf("k%d", i))
+		switch {
+		case i%4 == 0:
+			if !ok || v != nil {
+				t.Errorf("reinsert %v", i)
+			}
+		case i%2 == 0:
+			if ok {
+				t.Errorf("deleted %v", i)
+			}
+		default:
+			if !ok || *v.Id != i {
+				t.Errorf("get %v", i)
+			}
+		}
+	}
+
+	cnt := 0
+	d.m.Range(func(k string, v *PbItem) bool {
+		cnt++
+		return true
+	})
+	if cnt != d.m.Len() || cnt != n/2+n/4 {
+		t.Errorf("range: %v, len: %v", cnt, d.m.Len())
+	}
+}
+
+func Test_LacMapStructKey(t *testing.T) {
+	var ac *Allocator
+
+	type key struct {
+		a int8
+		b string
+		c float64
+	}
+	m := NewLacMap[key, int](ac, 16)
+	for i := 0; i < 100; i++ {
+		m.Set(key{int8(i), fmt.Sprint(i), float64(i)}, i)
+	}
+	for i := 0; i < 100; i++ {
+		if v, ok := m.Get(key{int8(i), fmt.Sprint(i), float64(i)}); !ok || v != i {
+			t.Errorf("get %v", i)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+/*
+ * Linear Allocator
+ *
+ * Improve the memory allocation and garbage collection performance.
+ *
+ * Copyright (C) 2020-2023 crazybie@github.com.
+ * https://github.com/crazybie/linear_ac
+ */
+
+// Package lactest provides helpers for testing Lac allocated objects.
+package lactest
+
+import (
+	"reflect"
+	"unsafe"
+)
+
+// same as nonNilPanickyAddr of lac, pointers are set to this value after invalidated in debug mode.
+const invalidAddr = uintptr(1)
+
+// DeepEqualArena reports whether a and b are deeply equal, like reflect.DeepEqual
+// but never dereferences the pointers invalidated by a released Allocator in debug mode,
+// such pointers, slices and strings are compared by their headers only.
+func DeepEqualArena[T any](a, b *T) bool {
+	return deepEqual(reflect.ValueOf(a), reflect.ValueOf(b), map[visit]struct{}{})
+}
+
+type visit struct {
+	a, b uintptr
+	tp   reflect.Type
+}
+
+// stringData returns the data pointer without dereferencing.
+func stringData(v reflect.Value) uintptr {
+	s := v.String()
+	return *(*uintptr)(unsafe.Pointer(&s))
+}
+
+func deepEqual(a, b reflect.Value, visited map[visit]struct{}) bool {
+	if a.Type() != b.Type() {
+		return false
+	}
+
+	switch a.Kind() {
+	case reflect.Ptr:
+		pa, pb := a.Pointer(), b.Pointer()
+		if pa == pb {
+			return true
+		}
+		if pa == 0 || pb == 0 || pa == invalidAddr || pb == invalidAddr {
+			return false
+		}
+		v := visit{pa, pb, a.Type()}
+		if _, ok := visited[v]; ok {
+			return true
+		}
+		visited[v] = struct{}{}
+		return deepEqual(a.Elem(), b.Elem(), visited)
+
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			if !deepEqual(a.Field(i), b.Field(i), visited) {
+				return false
+			}
+		}
+		return true
+
+	case reflect.Slice:
+		if a.IsNil() != b.IsNil() || a.Len() != b.Len() {
+			return false
+		}
+		if a.Pointer() == b.Pointer() {
+			return true
+		}
+		// invalidated slices have nil data with non-zero len.
+		if a.Pointer() == 0 || b.Pointer() == 0 {
+			return false
+		}
+		for i := 0; i < a.Len(); i++ {
+			if !deepEqual(a.Index(i), b.Index(i), visited) {
+				return false
+			}
+		}
+		return true
+
+	case reflect.Array:
+		for i := 0; i < a.Len(); i++ {
+			if !deepEqual(a.Index(i), b.Index(i), visited) {
+				return false
+			}
+		}
+		return true
+
+	case reflect.String:
+		if a.Len() != b.Len() {
+			return false
+		}
+		da, db := stringData(a), stringData(b)
+		if da == db {
+			return true
+		}
+		// invalidated strings have nil data with non-zero len.
+		if da == 0 || db == 0 {
+			return false
+		}
+		return a.String() == b.String()
+
+	case reflect.Map:
+		if a.IsNil() != b.IsNil() || a.Len() != b.Len() {
+			return false
+		}
+		if a.Pointer() == b.Pointer() {
+			return true
+		}
+		for iter := a.MapRange(); iter.Next(); {
+			v := b.MapIndex(iter.Key())
+			if !v.IsValid() || !deepEqual(iter.Value(), v, visited) {
+				return false
+			}
+		}
+		return true
+
+	case reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() == b.IsNil()
+		}
+		return deepEqual(a.Elem(), b.Elem(), visited)
+
+	case reflect.Func:
+		// same as reflect.DeepEqual.
+		return a.IsNil() && b.IsNil()
+
+	case reflect.Bool:
+		return a.Bool() == b.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() == b.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return a.Uint() == b.Uint()
+	case reflect.Float32, reflect.Float64:
+		return a.Float() == b.Float()
+	case reflect.Complex64, reflect.Complex128:
+		return a.Complex() == b.Complex()
+	case reflect.Chan, reflect.UnsafePointer:
+		return a.Pointer() == b.Pointer()
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+/*
+ * Linear Allocator
+ *
+ * Improve the memory allocation and garbage collection performance.
+ *
+ * Copyright (C) 2020-2023 crazybie@github.com.
+ * https://github.com/crazybie/linear_ac
+ */
+
+package lactest
+
+import (
+	"testing"
+
+	"linear_ac/lac"
+)
+
+type item struct {
+	Id   *int
+	Name string
+	Tags []string
+	m    map[int]*int
+	any  any
+}
+
+type data struct {
+	Items []*item
+	InUse *item
+	arr   [2]int
+}
+
+func newInt(i int) *int {
+	return &i
+}
+
+func build(ac *lac.Allocator) *data {
+	d := lac.New[data](ac)
+	for i := 0; i < 3; i++ {
+		it := lac.New[item](ac)
+		it.Id = ac.Int(i)
+		it.Name = ac.NewString("item")
+		it.Tags = lac.Append(ac, it.Tags, ac.NewString("a"), ac.NewString("b"))
+		it.m = lac.NewMap[int, *int](ac, 1)
+		it.m[i] = ac.Int(i)
+		it.any = ac.Int(i)
+		d.Items = lac.Append(ac, d.Items, it)
+	}
+	d.InUse = d.Items[1]
+	d.arr[1] = 1
+	return d
+}
+
+func Test_DeepEqualArena(t *testing.T) {
+	pool := lac.NewAllocatorPool("lactest", nil, 2, 1024, 0, 0)
+	pool.EnableDebugMode(true)
+
+	ac := pool.Get()
+	d := build(ac)
+	expected := build(nil)
+	if !DeepEqualArena(d, expected) {
+		t.Errorf("should be equal")
+	}
+	*expected.Items[2].Id = 3
+	if DeepEqualArena(d, expected) {
+		t.Errorf("should not be equal")
+	}
+
+	ac2 := pool.Get()
+	d2 := build(ac2)
+
+	// pointers are invalidated.
+	ac.Release()
+	ac2.Release()
+	if DeepEqualArena(d, expected) {
+		t.Errorf("invalidated should not be equal")
+	}
+	// compared by the invalidated headers without panicking.
+	if !DeepEqualArena(d, d2) {
+		t.Errorf("invalidated headers should be equal")
+	}
+	if !DeepEqualArena(d, d) {
+		t.Errorf("identical should be equal")
+	}
+	if !DeepEqualArena(&item{Id: newInt(1)}, &item{Id: newInt(1)}) {
+		t.Errorf("heap objects")
+	}
+}
@@ -0,0 +1,107 @@
+/*
+ * Linear Allocator
+ *
+ * Improve the memory allocation and garbage collection performance.
+ *
+ * Copyright (C) 2020-2023 crazybie@github.com.
+ * https://github.com/crazybie/linear_ac
+ */
+
+package lac
+
+// List is a doubly-linked list with nodes allocated from Lac, e.g. for queues and LRUs.
+// The memory of removed nodes are not reclaimed until the Allocator is released.
+type List[T any] struct {
+	head, tail *Node[T]
+	len        int
+}
+
+type Node[T any] struct {
+	Value      T
+	prev, next *Node[T]
+	list       *List[T]
+}
+
+func NewList[T any](ac *Allocator) *List[T] {
+	return New[List[T]](ac)
+}
+
+// Next returns the next node or nil.
+func (n *Node[T]) Next() *Node[T] {
+	return n.next
+}
+
+// Prev returns the previous node or nil.
+func (n *Node[T]) Prev() *Node[T] {
+	return n.prev
+}
+
+func (l *List[T]) Len() int {
+	return l.len
+}
+
+func (l *List[T]) Front() *Node[T] {
+	return l.head
+}
+
+func (l *List[T]) Back() *Node[T] {
+	return l.tail
+}
+
+func (l *List[T]) PushBack(ac *Allocator, v T) *Node[T] {
+	n := New[Node[T]](ac)
+	n.Value = v
+	n.list = l
+	n.prev = l.tail
+	if l.tail != nil {
+		l.tail.next = n
+	} else {
+		l.head = n
+	}
+	l.tail = n
+	l.len++
+	return n
+}
+
+func (l *List[T]) PushFront(ac *Allocator, v T) *Node[T] {
+	n := New[Node[T]](ac)
+	n.Value = v
+	n.list = l
+	n.next = l.head
+	if l.head != nil {
+		l.head.prev = n
+	} else {
+		l.tail = n
+	}
+	l.head = n
+	l.len++
+	return n
+}
+
+// Remove removes n from l, no-op if n is not in l.
+func (l *List[T]) Remove(n *Node[T]) {
+	if n.list != l {
+		return
+	}
+	if n.prev != nil {
+		n.prev.next = n.next
+	} else {
+		l.head = n.next
+	}
+	if n.next != nil {
+		n.next.prev = n.prev
+	} else {
+		l.tail = n.prev
+	}
+	n.prev, n.next, n.list = nil, nil, nil
+	l.len--
+}
+
+// Range calls f for each value from front to back until f returns false.
+func (l *List[T]) Range(f func(v T) bool) {
+	for n := l.head; n != nil; n = n.next {
+		if !f(n.Value) {
+			return
+		}
+	}
+}
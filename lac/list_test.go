@@ -0,0 +1,83 @@
+/*
+ * Linear Allocator
+ *
+ * Improve the memory allocation and garbage collection performance.
+ *
+ * Copyright (C) 2020-2023 crazybie@github.com.
+ * https://github.com/crazybie/linear_ac
+ */
+
+package lac
+
+import (
+	"runtime"
+	"testing"
+)
+
+func Test_List(t *testing.T) {
+	acPool.EnableDebugMode(true)
+	defer acPool.EnableDebugMode(false)
+	ac := acPool.Get()
+	defer ac.Release()
+
+	l := NewList[*PbItem](ac)
+	var nodes []*Node[*PbItem]
+	for i := 0; i < 100; i++ {
+		item := New[PbItem](ac)
+		item.Id = ac.Int(i)
+		nodes = append(nodes, l.PushBack(ac, item))
+		if i%10 == 0 {
+			runtime.GC()
+		}
+	}
+	l.PushFront(ac, nil)
+
+	// remove the nil and odd ones.
+	l.Remove(l.Front())
+	for i := 1; i < 100; i += 2 {
+		l.Remove(nodes[i])
+	}
+	l.Remove(nodes[1])
+	runtime.GC()
+
+	if l.Len() != 50 || *l.Front().Value.Id != 0 || *l.Back().Value.Id != 98 || l.Back().Prev() != nodes[96] {
+		t.Fatalf("len: %v", l.Len())
+	}
+	i := 0
+	l.Range(func(v *PbItem) bool {
+		if *v.Id != i {
+			t.Errorf("expected %v, got %v", i, *v.Id)
+		}
+		i += 2
+		return true
+	})
+
+	for n := l.Front(); n != nil; {
+		next := n.Next()
+		l.Remove(n)
+		n = next
+	}
+	if l.Len() != 0 || l.Front() != nil || l.Back() != nil {
+		t.Errorf("not empty")
+	}
+}
+
+func Test_ListCheck(t *testing.T) {
+	var n *Node[*int]
+	acPool.WithDebug(func() {
+		ac := acPool.Get()
+		defer ac.Release()
+
+		// cyclic references between nodes.
+		l := NewList[*int](ac)
+		n = l.PushBack(ac, ac.Int(1))
+		l.PushBack(ac, ac.Int(2))
+	})
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("should be invalidated")
+		}
+	}()
+	_ = *n.Next().Value
+}
@@ -0,0 +1,54 @@
+/*
+ * Linear Allocator
+ *
+ * Improve the memory allocation and garbage collection performance.
+ *
+ * Copyright (C) 2020-2023 crazybie@github.com.
+ * https://github.com/crazybie/linear_ac
+ */
+
+package lac
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// numaNodes returns the count of NUMA nodes, 1 if unknown.
+func numaNodes() int {
+	b, err := os.ReadFile("/sys/devices/system/node/online")
+	if err != nil {
+		return 1
+	}
+	return parseNodeList(strings.TrimSpace(string(b)))
+}
+
+// parseNodeList returns the max node id plus one of the kernel list format, e.g. "0-1,3".
+func parseNodeList(s string) int {
+	n := 0
+	for _, r := range strings.Split(s, ",") {
+		if i := strings.LastIndexByte(r, '-'); i >= 0 {
+			r = r[i+1:]
+		}
+		id, err := strconv.Atoi(r)
+		if err != nil {
+			return 1
+		}
+		n = max(n, id+1)
+	}
+	return max(n, 1)
+}
+
+// currentNumaNode returns the node of the cpu running the caller,
+// which may be stale right after returning as the goroutine can migrate.
+func currentNumaNode() int {
+	var cpu, node uint32
+	_, _, e := syscall.RawSyscall(sysGetcpu, uintptr(unsafe.Pointer(&cpu)), uintptr(unsafe.Pointer(&node)), 0)
+	if e != 0 {
+		return 0
+	}
+	return int(node)
+}
@@ -0,0 +1,16 @@
+//go:build linux && !amd64
+
+/*
+ * Linear Allocator
+ *
+ * Improve the memory allocation and garbage collection performance.
+ *
+ * Copyright (C) 2020-2023 crazybie@github.com.
+ * https://github.com/crazybie/linear_ac
+ */
+
+package lac
+
+import "syscall"
+
+const sysGetcpu = syscall.SYS_GETCPU
@@ -0,0 +1,20 @@
+/*
+ * Linear Allocator
+ *
+ * Improve the memory allocation and garbage collection performance.
+ *
+ * Copyright (C) 2020-2023 crazybie@github.com.
+ * https://github.com/crazybie/linear_ac
+ */
+
+package lac
+
+import "testing"
+
+func Test_ParseNodeList(t *testing.T) {
+	for s, n := range map[string]int{"0": 1, "0-1": 2, "0-1,3": 4, "2,0": 3, "": 1, "x": 1} {
+		if r := parseNodeList(s); r != n {
+			t.Errorf("%q: expected %v, got %v", s, n, r)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !linux
+
+/*
+ * Linear Allocator
+ *
+ * Improve the memory allocation and garbage collection performance.
+ *
+ * Copyright (C) 2020-2023 crazybie@github.com.
+ * https://github.com/crazybie/linear_ac
+ */
+
+package lac
+
+// NUMA is not supported on this platform, all chunks are from the shared pool.
+
+func numaNodes() int {
+	return 1
+}
+
+func currentNumaNode() int {
+	return 0
+}
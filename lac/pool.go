@@ -16,6 +16,12 @@
 
 package lac
 
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
 type Pool[T any] struct {
 	Logger
 	m      spinLock
@@ -31,15 +37,76 @@ type Pool[T any] struct {
 	// require CheckDuplication=true
 	// check duplicated put.
 	Equal func(a, b T) bool
+
+	// count of items dropped by Put due to Cap, consider raising Cap if it keeps growing.
+	droppedOnPut atomic.Int64
+	gets         atomic.Int64
+	puts         atomic.Int64
+	hits         atomic.Int64
+	misses       atomic.Int64
+}
+
+type PoolStats struct {
+	Gets int64
+	Puts int64
+	// Get served from the pool.
+	Hits int64
+	// Get served by New.
+	Misses  int64
+	Dropped int64
+}
+
+func (p *Pool[T]) Stats() PoolStats {
+	return PoolStats{
+		Gets:    p.gets.Load(),
+		Puts:    p.puts.Load(),
+		Hits:    p.hits.Load(),
+		Misses:  p.misses.Load(),
+		Dropped: p.droppedOnPut.Load(),
+	}
+}
+
+func (s PoolStats) HitRate() float64 {
+	if s.Gets == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Gets)
 }
 
 func (p *Pool[T]) Get() T {
 	p.m.Lock()
 	defer p.m.Unlock()
 
+	p.gets.Add(1)
 	if len(p.pool) == 0 {
+		p.misses.Add(1)
 		return p.doNew()
 	}
+	return p.pop()
+}
+
+var ErrPoolExhausted = errors.New("pool exhausted")
+
+// TryGet is same as Get but returns ErrPoolExhausted instead of reporting when exceeding MaxNew,
+// useful for logging the context and continuing in debug harness.
+func (p *Pool[T]) TryGet() (T, error) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	p.gets.Add(1)
+	if len(p.pool) == 0 {
+		p.misses.Add(1)
+		if p.MaxNew > 0 && p.newCnt >= p.MaxNew {
+			var zero T
+			return zero, fmt.Errorf("%s: %w (%v), potential leak", p.Name, ErrPoolExhausted, p.MaxNew)
+		}
+		return p.doNew(), nil
+	}
+	return p.pop(), nil
+}
+
+func (p *Pool[T]) pop() T {
+	p.hits.Add(1)
 
 	last := len(p.pool) - 1
 	r := p.pool[last]
@@ -60,7 +127,25 @@ func (p *Pool[T]) doNew() T {
 func (p *Pool[T]) Put(v T) bool {
 	p.m.Lock()
 	defer p.m.Unlock()
+	return p.put(v)
+}
+
+// PutAll puts items back with a single lock, returns the count of accepted items.
+func (p *Pool[T]) PutAll(items []T) int {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	n := 0
+	for _, v := range items {
+		if p.put(v) {
+			n++
+		}
+	}
+	return n
+}
 
+func (p *Pool[T]) put(v T) bool {
+	p.puts.Add(1)
 	if p.CheckDuplication && p.Equal != nil {
 		for _, i := range p.pool {
 			if p.Equal(i, v) {
@@ -73,10 +158,15 @@ func (p *Pool[T]) Put(v T) bool {
 		p.pool = append(p.pool, v)
 		return true
 	} else {
+		p.droppedOnPut.Add(1)
 		return false
 	}
 }
 
+func (p *Pool[T]) DroppedOnPut() int64 {
+	return p.droppedOnPut.Load()
+}
+
 func (p *Pool[T]) Clear() {
 	p.m.Lock()
 	defer p.m.Unlock()
@@ -100,3 +190,31 @@ func (p *Pool[T]) DebugCheck() {
 		errorf(p, "%s: %d leaked. cur:%v,max: %v", p.Name, p.newCnt-l, p.newCnt, l)
 	}
 }
+
+// FreeList recycles short-lived objects within the lifetime of an Allocator,
+// to reduce the consumption of Lac for churny objects created and dropped many times before releasing.
+// Never use it or the objects from it after the Allocator is released.
+type FreeList[T any] struct {
+	pool Pool[*T]
+}
+
+// NewFreeList creates a FreeList from heap, it must not be allocated from Lac
+// because the pooled slice is allocated from heap.
+func NewFreeList[T any](ac *Allocator) *FreeList[T] {
+	f := &FreeList[T]{}
+	f.pool.Name = "LacFreeList"
+	f.pool.New = func() *T { return New[T](ac) }
+	return f
+}
+
+// GetOne returns a zeroed object.
+func (f *FreeList[T]) GetOne() *T {
+	r := f.pool.Get()
+	var zero T
+	*r = zero
+	return r
+}
+
+func (f *FreeList[T]) PutOne(v *T) {
+	f.pool.Put(v)
+}
@@ -9,7 +9,10 @@
 
 package lac
 
-import "testing"
+import (
+	"errors"
+	"testing"
+)
 
 func Test_PoolDebug(t *testing.T) {
 	p := Pool[int]{
@@ -36,6 +39,9 @@ func Test_PoolMemLeak(t *testing.T) {
 	if len(p.pool) > 1 {
 		t.Errorf("memory leaked")
 	}
+	if p.DroppedOnPut() != 1 {
+		t.Errorf("dropped: %v", p.DroppedOnPut())
+	}
 }
 
 func Test_PoolExceedMaxNew(t *testing.T) {
@@ -54,3 +60,91 @@ func Test_PoolExceedMaxNew(t *testing.T) {
 	p.Get()
 	p.Get()
 }
+
+func Test_PoolTryGet(t *testing.T) {
+	p := Pool[int]{
+		New:    func() int { return 1 },
+		MaxNew: 2,
+	}
+	for i := 0; i < 2; i++ {
+		if v, err := p.TryGet(); err != nil || v != 1 {
+			t.Fatalf("v: %v, err: %v", v, err)
+		}
+	}
+	if _, err := p.TryGet(); !errors.Is(err, ErrPoolExhausted) {
+		t.Errorf("err: %v", err)
+	}
+	p.Put(2)
+	if v, err := p.TryGet(); err != nil || v != 2 {
+		t.Errorf("v: %v, err: %v", v, err)
+	}
+}
+
+func Test_PoolPutAll(t *testing.T) {
+	p := Pool[int]{
+		New: func() int { return 0 },
+		Cap: 3,
+	}
+	p.Put(1)
+	if n := p.PutAll([]int{2, 3, 4}); n != 2 {
+		t.Errorf("accepted: %v", n)
+	}
+	if len(p.pool) != 3 {
+		t.Errorf("pool size: %v", len(p.pool))
+	}
+}
+
+func Test_PoolPutAllDebug(t *testing.T) {
+	p := Pool[int]{
+		CheckDuplication: true,
+		New:              func() int { return 0 },
+		Equal:            func(a, b int) bool { return a == b },
+	}
+	defer func() {
+		if err := recover(); err == nil {
+			panic("duplicated item not detected")
+		}
+	}()
+	p.PutAll([]int{1, 2, 1})
+}
+
+func Test_FreeList(t *testing.T) {
+	ac := acPool.Get()
+	defer ac.Release()
+
+	f := NewFreeList[PbItem](ac)
+	a := f.GetOne()
+	a.Id = ac.Int(1)
+	f.PutOne(a)
+
+	b := f.GetOne()
+	if b != a {
+		t.Errorf("not recycled")
+	}
+	if b.Id != nil {
+		t.Errorf("not zeroed")
+	}
+	if c := f.GetOne(); c == a {
+		t.Errorf("duplicated")
+	}
+}
+
+func Test_PoolStats(t *testing.T) {
+	p := Pool[int]{
+		New: func() int { return 0 },
+		Cap: 1,
+	}
+	p.Reserve(1)
+	p.Put(p.Get())
+	p.Get()
+	p.Get()
+	p.PutAll([]int{1, 2})
+
+	s := p.Stats()
+	if s != (PoolStats{Gets: 3, Puts: 3, Hits: 2, Misses: 1, Dropped: 1}) {
+		t.Errorf("stats: %+v", s)
+	}
+	if r := s.HitRate(); r < 0.66 || r > 0.67 {
+		t.Errorf("hit rate: %v", r)
+	}
+}
@@ -0,0 +1,64 @@
+/*
+ * Linear Allocator
+ *
+ * Improve the memory allocation and garbage collection performance.
+ *
+ * Copyright (C) 2020-2023 crazybie@github.com.
+ * https://github.com/crazybie/linear_ac
+ */
+
+package lac
+
+// RingBuffer is a FIFO queue backed by a slice allocated from Lac, e.g. for bounded event queues.
+// It grows by copying into a larger slice when full, the old one is not reclaimed until the Allocator is released.
+type RingBuffer[T any] struct {
+	buf  []T
+	head int
+	len  int
+}
+
+func NewRing[T any](ac *Allocator, cap int) *RingBuffer[T] {
+	r := New[RingBuffer[T]](ac)
+	r.buf = NewSlice[T](ac, cap, cap)
+	return r
+}
+
+func (r *RingBuffer[T]) Len() int {
+	return r.len
+}
+
+func (r *RingBuffer[T]) Cap() int {
+	return len(r.buf)
+}
+
+// Push appends v to the back, ac must be the one allocating r.
+func (r *RingBuffer[T]) Push(ac *Allocator, v T) {
+	if r.len == len(r.buf) {
+		r.grow(ac)
+	}
+	r.buf[(r.head+r.len)%len(r.buf)] = v
+	r.len++
+}
+
+// Pop removes and returns the front value, ok is false if empty.
+func (r *RingBuffer[T]) Pop() (v T, ok bool) {
+	if r.len == 0 {
+		return v, false
+	}
+	var zero T
+	v = r.buf[r.head]
+	// drop the reference for the pointer checker.
+	r.buf[r.head] = zero
+	r.head = (r.head + 1) % len(r.buf)
+	r.len--
+	return v, true
+}
+
+func (r *RingBuffer[T]) grow(ac *Allocator) {
+	n := max(len(r.buf)*2, 8)
+	buf := NewSlice[T](ac, n, n)
+	m := copy(buf, r.buf[r.head:])
+	copy(buf[m:], r.buf[:r.head])
+	r.buf = buf
+	r.head = 0
+}
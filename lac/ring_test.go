@@ -0,0 +1,102 @@
+/*
+ * Linear Allocator
+ *
+ * Improve the memory allocation and garbage collection performance.
+ *
+ * Copyright (C) 2020-2023 crazybie@github.com.
+ * https://github.com/crazybie/linear_ac
+ */
+
+package lac
+
+import (
+	"runtime"
+	"testing"
+)
+
+func Test_RingWrapAround(t *testing.T) {
+	ac := acPool.Get()
+	defer ac.Release()
+
+	r := NewRing[int](ac, 4)
+	next, expected := 0, 0
+	for round := 0; round < 10; round++ {
+		// keep 3 in the buffer so head wraps around without growing.
+		for r.Len() < 3 {
+			r.Push(ac, next)
+			next++
+		}
+		for i := 0; i < 2; i++ {
+			v, ok := r.Pop()
+			if !ok || v != expected {
+				t.Fatalf("expected %v, got %v", expected, v)
+			}
+			expected++
+		}
+	}
+	if r.Cap() != 4 {
+		t.Errorf("should not grow: %v", r.Cap())
+	}
+
+	// grow while wrapped.
+	for i := 0; i < 10; i++ {
+		r.Push(ac, next)
+		next++
+	}
+	if r.Cap() <= 4 || r.Len() != next-expected {
+		t.Errorf("cap: %v, len: %v", r.Cap(), r.Len())
+	}
+	for r.Len() > 0 {
+		if v, _ := r.Pop(); v != expected {
+			t.Fatalf("expected %v, got %v", expected, v)
+		}
+		expected++
+	}
+	if _, ok := r.Pop(); ok {
+		t.Errorf("should be empty")
+	}
+
+	z := NewRing[int](ac, 0)
+	z.Push(ac, 1)
+	if v, ok := z.Pop(); !ok || v != 1 {
+		t.Errorf("zero cap")
+	}
+}
+
+func Test_RingGC(t *testing.T) {
+	acPool.EnableDebugMode(true)
+	defer acPool.EnableDebugMode(false)
+	ac := acPool.Get()
+	defer ac.Release()
+
+	r := NewRing[*PbItem](ac, 2)
+	for i := 0; i < 100; i++ {
+		item := New[PbItem](ac)
+		item.Id = ac.Int(i)
+		// heap objects must be attached.
+		item.Name = Attach(ac, new(string))
+		r.Push(ac, item)
+		if i%10 == 0 {
+			runtime.GC()
+		}
+		if i%3 == 0 {
+			r.Pop()
+		}
+	}
+	runtime.GC()
+
+	if err := ac.CheckExternalPointersOf(r); err != nil {
+		t.Errorf("unexpected: %v", err)
+	}
+	prev := -1
+	for r.Len() > 0 {
+		v, _ := r.Pop()
+		if *v.Id <= prev || v.Name == nil {
+			t.Fatalf("unexpected item %v after %v", *v.Id, prev)
+		}
+		prev = *v.Id
+	}
+	if prev != 99 {
+		t.Errorf("last: %v", prev)
+	}
+}
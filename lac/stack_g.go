@@ -0,0 +1,29 @@
+//go:build amd64 || arm64
+
+/*
+ * Linear Allocator
+ *
+ * Improve the memory allocation and garbage collection performance.
+ *
+ * Copyright (C) 2020-2023 crazybie@github.com.
+ * https://github.com/crazybie/linear_ac
+ */
+
+package lac
+
+import "unsafe"
+
+// getg returns the runtime g of the current goroutine.
+func getg() unsafe.Pointer
+
+// the first field of the runtime g, the offset is known to runtime/cgo.
+type gStack struct {
+	lo, hi uintptr
+}
+
+// onCurrentStack reports whether addr is in the stack of the current goroutine.
+// pointers to the stacks of other goroutines are not recognized.
+func onCurrentStack(addr uintptr) bool {
+	s := (*gStack)(getg())
+	return addr >= s.lo && addr < s.hi
+}
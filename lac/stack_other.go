@@ -0,0 +1,17 @@
+//go:build !amd64 && !arm64
+
+/*
+ * Linear Allocator
+ *
+ * Improve the memory allocation and garbage collection performance.
+ *
+ * Copyright (C) 2020-2023 crazybie@github.com.
+ * https://github.com/crazybie/linear_ac
+ */
+
+package lac
+
+// onCurrentStack always reports false, the stack bounds are only read on amd64 and arm64.
+func onCurrentStack(addr uintptr) bool {
+	return false
+}
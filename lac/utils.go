@@ -19,13 +19,11 @@ import (
 
 const (
 	flagIndir uintptr = 1 << 7
+	flagRO    uintptr = 1<<5 | 1<<6
 	ptrSize           = int(unsafe.Sizeof(uintptr(0)))
 )
 
 func init() {
-	if ptrSize != 8 {
-		panic("expect 64bit platform")
-	}
 	if unsafe.Sizeof(sliceHeader{}) != unsafe.Sizeof(reflect.SliceHeader{}) {
 		panic("ABI not match")
 	}
@@ -42,8 +40,18 @@ func init() {
 
 type sliceHeader struct {
 	Data unsafe.Pointer
-	Len  int64
-	Cap  int64
+	Len  int
+	Cap  int
+}
+
+// loadLen and casLen access the bump pointer of the chunk h atomically,
+// Len is int to match the runtime slice layout on both 32bit and 64bit platforms.
+func loadLen(h *sliceHeader) int {
+	return int(atomic.LoadUintptr((*uintptr)(unsafe.Pointer(&h.Len))))
+}
+
+func casLen(h *sliceHeader, old, new int) bool {
+	return atomic.CompareAndSwapUintptr((*uintptr)(unsafe.Pointer(&h.Len)), uintptr(old), uintptr(new))
 }
 
 type stringHeader struct {
@@ -70,6 +78,12 @@ func memclrNoHeapPointers(ptr unsafe.Pointer, n uintptr)
 //go:noescape
 func memmoveNoHeapPointers(to, from unsafe.Pointer, n uintptr)
 
+// typehash hashes the object of type t at address p, t is the runtime type descriptor.
+//
+//go:linkname typehash runtime.typehash
+//go:noescape
+func typehash(t unsafe.Pointer, p unsafe.Pointer, h uintptr) uintptr
+
 func data(i interface{}) unsafe.Pointer {
 	return (*emptyInterface)(unsafe.Pointer(&i)).Data
 }
@@ -87,6 +101,18 @@ func interfaceOfUnexported(v reflect.Value) (ret interface{}) {
 	return
 }
 
+// addressableOf returns v if it is addressable, otherwise an addressable copy of v,
+// e.g. the struct values in maps, even obtained via unexported fields.
+func addressableOf(v reflect.Value) reflect.Value {
+	if v.CanAddr() {
+		return v
+	}
+	(*reflectedValue)(unsafe.Pointer(&v)).flag &^= flagRO
+	r := reflect.New(v.Type()).Elem()
+	r.Set(v)
+	return r
+}
+
 func interfaceEqual(a, b any) bool {
 	return *(*emptyInterface)(unsafe.Pointer(&a)) == *(*emptyInterface)(unsafe.Pointer(&b))
 }
@@ -126,6 +152,15 @@ func errorf(logger Logger, format string, args ...any) {
 	}
 }
 
+// warnf logs to the logger or stdout if nil, never panics.
+func warnf(logger Logger, format string, args ...any) {
+	if logger != nil {
+		logger.Errorf(format, args...)
+	} else {
+		fmt.Printf(format, args...)
+	}
+}
+
 func mayContainsPtr(k reflect.Kind) bool {
 	switch k {
 	case reflect.Bool,
@@ -148,6 +183,36 @@ func mayContainsPtr(k reflect.Kind) bool {
 	return true
 }
 
+// kinds of the allocated types keyed by the type descriptor of *T,
+// copy-on-write since only a few types are added once.
+var typeKinds atomic.Pointer[map[unsafe.Pointer]reflect.Kind]
+
+// typeKind returns the kind of T, cached to keep the reflection out of the allocation path.
+func typeKind[T any]() reflect.Kind {
+	var i interface{} = (*T)(nil)
+	key := (*emptyInterface)(unsafe.Pointer(&i)).Type
+	if m := typeKinds.Load(); m != nil {
+		if k, ok := (*m)[key]; ok {
+			return k
+		}
+	}
+
+	k := reflect.TypeOf((*T)(nil)).Elem().Kind()
+	for {
+		old := typeKinds.Load()
+		m := map[unsafe.Pointer]reflect.Kind{}
+		if old != nil {
+			for t, v := range *old {
+				m[t] = v
+			}
+		}
+		m[key] = k
+		if typeKinds.CompareAndSwap(old, &m) {
+			return k
+		}
+	}
+}
+
 func noMalloc(f func()) {
 	var s, e runtime.MemStats
 	runtime.ReadMemStats(&s)
@@ -183,6 +248,7 @@ func (s *spinLock) Unlock() {
 type weakUniqQueue[T any] struct {
 	spinLock
 	slice     []T
+	size      int32 // atomic mirror of len(slice), allows clearing an empty queue without locking.
 	uniqRange int
 	equal     func(a, b T) bool
 }
@@ -192,14 +258,34 @@ func newWeakUniqQueue[T any](uniqRange int, eq func(a, b T) bool) weakUniqQueue[
 }
 
 func (e *weakUniqQueue[T]) Clear() {
+	if atomic.LoadInt32(&e.size) == 0 {
+		return
+	}
 	e.Lock()
 	defer e.Unlock()
 	e.slice = nil
+	atomic.StoreInt32(&e.size, 0)
 }
 
 func (e *weakUniqQueue[T]) Put(a T) {
 	e.Lock()
 	defer e.Unlock()
+	e.put(a)
+}
+
+// PutAll puts items with a single lock.
+func (e *weakUniqQueue[T]) PutAll(items []T) {
+	if len(items) == 0 {
+		return
+	}
+	e.Lock()
+	defer e.Unlock()
+	for _, a := range items {
+		e.put(a)
+	}
+}
+
+func (e *weakUniqQueue[T]) put(a T) {
 	if l := len(e.slice); l > 0 {
 		if l < e.uniqRange {
 			for _, k := range e.slice {
@@ -214,6 +300,7 @@ func (e *weakUniqQueue[T]) Put(a T) {
 		}
 	}
 	e.slice = append(e.slice, a)
+	atomic.StoreInt32(&e.size, int32(len(e.slice)))
 }
 
 func anyEq(a, b any) bool {